@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"teleskopio/pkg/config"
@@ -26,17 +28,22 @@ import (
 var logOutput = os.Stdout
 
 type App struct {
-	Config   *config.Config
-	Clusters []*config.Cluster
-	Users    *config.Users
-	signchnl chan (os.Signal)
-	exitSig  chan (os.Signal)
-	isReady  bool
-	mu       sync.Mutex
+	Config     *config.Config
+	Clusters   []*config.Cluster
+	Users      *config.Users
+	Store      *config.ClusterStore
+	configPath string
+	current    *config.Current
+	kapi       *kubeapi.KubeAPI
+	logLevel   *slog.LevelVar
+	signchnl   chan (os.Signal)
+	exitSig    chan (os.Signal)
+	isReady    bool
+	mu         sync.Mutex
 }
 
 func New(version string, configPath string, exitchnl, signchnl chan (os.Signal)) (*App, error) {
-	app := &App{exitSig: exitchnl, signchnl: signchnl}
+	app := &App{exitSig: exitchnl, signchnl: signchnl, configPath: configPath}
 	cfg, clusters, users, err := config.Parse(configPath)
 	if err != nil {
 		return app, err
@@ -44,16 +51,40 @@ func New(version string, configPath string, exitchnl, signchnl chan (os.Signal))
 	app.Config = &cfg
 	app.Config.Version = version
 	app.Clusters = clusters
-	app.Config = &cfg
 	app.Users = &users
-	initLogger(&cfg)
+	app.logLevel = initLogger(&cfg)
 	slog.Info("read config at", "path", configPath)
 	if err := cfg.Validate(); err != nil {
 		return app, err
 	}
+	store, err := config.NewClusterStore(cfg.Kube.Store)
+	if err != nil {
+		return app, err
+	}
+	app.Store = store
+	app.Clusters = storedClusters(&cfg.Kube, store, app.Clusters)
+	app.current = config.NewCurrent(app.Config, app.Users)
 	return app, nil
 }
 
+// storedClusters adds the clusters persisted at runtime, the ones named as a
+// configured cluster are skipped.
+func storedClusters(kube *config.Kube, store *config.ClusterStore, clusters []*config.Cluster) []*config.Cluster {
+	for _, sc := range store.Clusters() {
+		if slices.ContainsFunc(clusters, func(c *config.Cluster) bool { return c.Name == sc.Name }) {
+			slog.Warn("duplicated cluster name, skip the stored cluster", "name", sc.Name)
+			continue
+		}
+		cluster, err := kube.FromKubeconfig([]byte(sc.Kubeconfig), sc.Context, sc.Name, sc.Labels)
+		if err != nil {
+			slog.Error("cant load stored cluster", "name", sc.Name, "err", err.Error())
+			continue
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
 func (a *App) Run(staticFiles embed.FS) error {
 	slog.Info("version", "version", a.Config.Version)
 	a.mu.Lock()
@@ -62,15 +93,26 @@ func (a *App) Run(staticFiles embed.FS) error {
 	}
 	a.isReady = true
 	a.mu.Unlock()
+	if a.Config.WatchConfig {
+		if err := a.watchConfig(); err != nil {
+			slog.Error("cant watch config", "path", a.configPath, "err", err.Error())
+		}
+	}
 	go func() {
-		code := <-a.signchnl
-		slog.Info("os signal received", "signal", code)
-		a.exitSig <- code
+		for code := range a.signchnl {
+			slog.Info("os signal received", "signal", code)
+			if code == syscall.SIGHUP {
+				a.Reload()
+				continue
+			}
+			a.exitSig <- code
+			return
+		}
 	}()
 	return nil
 }
 
-func initLogger(cfg *config.Config) {
+func initLogger(cfg *config.Config) *slog.LevelVar {
 	level := new(slog.LevelVar)
 	handler := &slog.HandlerOptions{
 		Level: level,
@@ -92,6 +134,7 @@ func initLogger(cfg *config.Config) {
 	}
 	slog.SetDefault(logger)
 	slog.Info("set loglevel", "level", level)
+	return level
 }
 
 //nolint:funlen
@@ -99,30 +142,28 @@ func (a *App) initServer(staticFiles embed.FS) error {
 	slog.Info("initialize web server", "addr", a.Config.ServerHTTP)
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	mdlwr := middleware.New(a.Config)
+	mdlwr := middleware.New(a.current)
 	router.Use(mdlwr.Logger())
 	router.Use(gin.Recovery())
 	router.Use(mdlwr.CORS())
 	hub := webSocket.NewHub()
 	go hub.Run()
 
-	kapi := kubeapi.New(a.Clusters)
-	r, err := httpRouter.New(hub, a.Config, kapi, a.Users)
+	kapi := kubeapi.New(a.Config, a.Clusters)
+	go kapi.Run()
+	a.kapi = kapi
+	r, err := httpRouter.New(hub, a.current, kapi, a.Store)
 	if err != nil {
 		return err
 	}
 	if a.Config.MCP.Enabled {
 		slog.Info("mcp enabled", "api_key", len(a.Config.MCP.APIKey))
 		if a.Config.MCP.APIKey != "" {
-			if a.Config.MCP.APIKeyHeader == "" {
-				a.Config.MCP.APIKeyHeader = "X-MCP"
-				slog.Warn("mcp.api_key_header is empty set default", "default", a.Config.MCP.APIKeyHeader)
-			}
 			router.Use(mdlwr.MCPProtect())
 		}
 		mcp.LoadPrompts(
 			mcp.LoadTools(
-				mcp.New(*a.Config, kapi).SetupRoutes(router),
+				mcp.New(a.current, kapi).SetupRoutes(router),
 			),
 		)
 	}
@@ -137,6 +178,7 @@ func (a *App) initServer(staticFiles embed.FS) error {
 		"/helm",
 		"/createkubernetesresource",
 		"/resource/Logs/:namespace/:name",
+		"/resource/WorkloadLogs/:kind/:namespace/:name",
 		"/yaml/:resource/:name/:namespace",
 		"/resource/:resource",
 	} {
@@ -145,7 +187,7 @@ func (a *App) initServer(staticFiles embed.FS) error {
 		})
 	}
 	router.NoRoute(func(c *gin.Context) {
-		slog.Debug("hit no route", "request uri", c.Request.RequestURI, "method", c.Request.Method)
+		slog.Debug("hit no route", "path", c.Request.URL.Path, "method", c.Request.Method)
 		if strings.HasPrefix(c.Request.URL.Path, "/yaml") {
 			re := regexp.MustCompile(`^(/[^/]+){3}`)
 			newPath := re.ReplaceAllString(c.Request.URL.Path, "")
@@ -154,6 +196,14 @@ func (a *App) initServer(staticFiles embed.FS) error {
 			c.FileFromFS(newPath, indexfs)
 			return
 		}
+		if strings.HasPrefix(c.Request.URL.Path, "/resource/WorkloadLogs") {
+			re := regexp.MustCompile(`^(/[^/]+){4}`)
+			newPath := re.ReplaceAllString(c.Request.URL.Path, "")
+			c.Request.RequestURI = newPath
+			c.Request.URL.Path = newPath
+			c.FileFromFS(newPath, indexfs)
+			return
+		}
 		if strings.HasPrefix(c.Request.URL.Path, "/resource/Logs") {
 			re := regexp.MustCompile(`^(/[^/]+){3}`)
 			newPath := re.ReplaceAllString(c.Request.URL.Path, "")
@@ -188,15 +238,18 @@ func (a *App) initServer(staticFiles embed.FS) error {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "not ready"})
 	})
 	router.GET("/api/auth_disabled", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"message": a.Config.AuthDisabled})
+		c.JSON(http.StatusOK, gin.H{"message": a.current.Get().AuthDisabled})
 	})
 	router.POST("/api/login", r.Login)
-	router.POST("/api/cleanup", r.CleanUp)
+	router.GET("/api/oidc_enabled", r.OIDCEnabled)
+	router.GET("/api/oidc/login", r.OIDCLogin)
+	router.GET("/api/oidc/callback", r.OIDCCallback)
 	auth := router.Group("/api")
 	auth.Use(mdlwr.Auth())
 	auth.GET("/lookup_configs", r.LookupConfigs)
 	auth.POST("/get_version", r.GetVersion)
 	auth.POST("/list_apiresources", r.ListResources)
+	auth.POST("/invalidate_discovery", r.InvalidateDiscovery)
 	auth.POST("/list_dynamic_resource", r.ListDynamicResource)
 	auth.POST("/list_crd_resource", r.ListCustomResourceDefinitions)
 	auth.POST("/list_events_dynamic_resource", r.ListEventsDynamicResource)
@@ -206,17 +259,47 @@ func (a *App) initServer(staticFiles embed.FS) error {
 	auth.POST("/get_pod_logs", r.GetPodLogs)
 	auth.POST("/stop_pod_log_stream", r.StopStreamPodLogs)
 	auth.POST("/stream_pod_logs", r.StreamPodLogs)
-	auth.POST("/delete_dynamic_resources", mdlwr.CheckRole(), r.DeleteDynamicResources)
-	auth.POST("/create_kube_resource", mdlwr.CheckRole(), r.CreateKubeResource)
-	auth.POST("/update_kube_resource", mdlwr.CheckRole(), r.UpdateKubeResource)
-	auth.POST("/cordon_node", mdlwr.CheckRole(), r.NodeOperation)
-	auth.POST("/uncordon_node", mdlwr.CheckRole(), r.NodeOperation)
-	auth.POST("/drain_node", mdlwr.CheckRole(), r.NodeDrain)
-	auth.POST("/scale_resource", mdlwr.CheckRole(), r.ScaleResource)
-	auth.POST("/trigger_cronjob", mdlwr.CheckRole(), r.TriggerCronjob)
-	auth.POST("/helm_releases", mdlwr.CheckRole(), r.ListHelmReleases)
-	auth.POST("/helm_release", mdlwr.CheckRole(), r.GetHelmRelease)
-	webSocket.SetupWebsocket(hub, router)
+	auth.POST("/stream_logs", r.StreamLogs)
+	auth.POST("/stop_logs", r.StopLogs)
+	auth.POST("/delete_dynamic_resources", r.DeleteDynamicResources)
+	auth.POST("/create_kube_resource", r.CreateKubeResource)
+	auth.POST("/update_kube_resource", r.UpdateKubeResource)
+	auth.POST("/apply_kube_resource", r.ApplyKubeResource)
+	auth.POST("/diff_kube_resource", r.DiffKubeResource)
+	auth.POST("/cordon_node", r.NodeOperation)
+	auth.POST("/uncordon_node", r.NodeOperation)
+	auth.POST("/drain_node", r.NodeDrain)
+	auth.POST("/watch_drain", r.WatchDrain)
+	auth.POST("/scale_resource", r.ScaleResource)
+	auth.POST("/trigger_cronjob", r.TriggerCronjob)
+	auth.POST("/helm_releases", r.ListHelmReleases)
+	auth.POST("/helm_release", r.GetHelmRelease)
+	auth.POST("/helm_history", r.HelmHistory)
+	auth.POST("/helm_rollback", r.HelmRollback)
+	auth.POST("/helm_uninstall", r.HelmUninstall)
+	auth.POST("/helm_upgrade", r.HelmUpgrade)
+	auth.POST("/helm_local_charts", r.HelmLocalCharts)
+	auth.POST("/helm_install", r.HelmInstall)
+	auth.POST("/helm_diff", r.HelmDiff)
+	auth.GET("/audit", r.ListAudit)
+	auth.POST("/add_cluster", r.AddCluster)
+	auth.POST("/remove_cluster", r.RemoveCluster)
+	auth.POST("/test_cluster", r.TestCluster)
+	auth.POST("/port_forward", r.StartPortForward)
+	auth.POST("/port_forwards", r.ListPortForwards)
+	auth.POST("/stop_port_forward", r.StopPortForward)
+	auth.POST("/logout", r.Logout)
+	auth.POST("/rollout_restart", r.RolloutRestart)
+	auth.POST("/rollout_pause", r.RolloutPause)
+	auth.POST("/rollout_resume", r.RolloutResume)
+	auth.POST("/rollout_undo", r.RolloutUndo)
+	auth.POST("/rollout_history", r.RolloutHistory)
+	auth.POST("/rollout_status", r.RolloutStatus)
+	webSocket.SetupWebsocket(hub, router, mdlwr.WebsocketAuth())
+	router.GET("/api/exec", mdlwr.WebsocketAuth(), r.ExecPod)
+	router.GET("/api/port_forward_tunnel", mdlwr.WebsocketAuth(), r.TunnelPortForward)
+	// a plain link, the token comes in the query like the websockets
+	router.GET("/api/download_pod_logs", mdlwr.WebsocketAuth(), r.DownloadPodLogs)
 
 	go func() {
 		addr := a.Config.ServerHTTP
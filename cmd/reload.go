@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"teleskopio/pkg/config"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// the editors and the ConfigMap volume update the file in several steps
+const reloadDebounce = time.Second
+
+// Reload parses the config again and swaps users, roles, MCP settings, log
+// level and clusters. The unchanged clusters keep their watchers, an invalid
+// config is logged and the current one is kept. Server, OIDC, audit and
+// kube cache settings need a restart.
+func (a *App) Reload() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cfg, clusters, users, err := config.Parse(a.configPath)
+	if err != nil {
+		slog.Error("reload config", "path", a.configPath, "err", err.Error())
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		slog.Error("reload config", "path", a.configPath, "err", err.Error())
+		return
+	}
+	cfg.Version = a.Config.Version
+	clusters = storedClusters(&cfg.Kube, a.Store, clusters)
+	if err := a.logLevel.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		slog.Warn("reload config, keep log level", "err", err.Error())
+	}
+	a.Config, a.Clusters, a.Users = &cfg, clusters, &users
+	a.current.Set(a.Config, a.Users)
+	if a.kapi != nil {
+		a.kapi.SyncClusters(clusters)
+	}
+	slog.Info("config reloaded", "path", a.configPath, "clusters", len(clusters), "users", len(users.Users))
+}
+
+// watchConfig reloads the config when the file changes. The directory is
+// watched as the ConfigMap volumes replace the file with a symlink swap.
+func (a *App) watchConfig() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(a.configPath)
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+	slog.Info("watch config", "path", path)
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(ev.Name) != filepath.Base(path) && filepath.Base(ev.Name) != "..data" {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDebounce, a.Reload)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("watch config", "err", err.Error())
+			}
+		}
+	}()
+	return nil
+}
@@ -11,7 +11,6 @@ import { flushAllStates } from '@/store/resources';
 import { useCrdResourcesState } from '@/store/crdResources';
 import { Input } from '@/components/ui/input';
 import { useConfig } from '@/context/ConfigContext';
-import { cleanup } from '@/lib/api';
 
 export function Header({
   setSearchQuery,
@@ -111,7 +110,6 @@ export function Header({
             className="bg-red-500 hover:bg-red-400"
             onClick={() => {
               toast.warning(<div>Disconnect from cluster {serverInfo?.server}</div>);
-              cleanup();
               deleteConfig();
               flushAllStates();
               crdResources.set(new Map());
@@ -5,6 +5,7 @@ import { Card, CardContent } from '@/components/ui/card';
 import { Input } from '@/components/ui/input';
 import { toast } from 'sonner';
 import { Telescope } from 'lucide-react';
+import { useAuth } from '@/context/AuthProvider';
 
 type LoginFormProps = React.ComponentProps<'div'> & {
   login: (username: string, password: string) => Promise<boolean | void>;
@@ -13,6 +14,7 @@ type LoginFormProps = React.ComponentProps<'div'> & {
 export function LoginForm({ login, className, ...props }: LoginFormProps) {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
+  const { OIDCEnabled } = useAuth();
   return (
     <div className={cn('flex flex-col gap-6', className)} {...props}>
       <Card>
@@ -55,6 +57,17 @@ export function LoginForm({ login, className, ...props }: LoginFormProps) {
               >
                 Login
               </Button>
+              {OIDCEnabled && (
+                <Button
+                  variant="outline"
+                  onClick={() => {
+                    window.location.href = '/api/oidc/login';
+                  }}
+                  className="w-full text-xs"
+                >
+                  Login with SSO
+                </Button>
+              )}
             </div>
             <div className="flex flex-col items-center">
               <div className="flex flex-row">
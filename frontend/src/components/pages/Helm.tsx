@@ -10,8 +10,8 @@ import { toast } from 'sonner';
 import { Header } from '@/components/Header';
 import { useSelectedNamespacesState } from '@/store/selectedNamespace';
 import { useWS } from '@/context/WsContext';
-import { useConfig } from '@/context/ConfigContext';
 import { addSubscription } from '@/lib/subscriptionManager';
+import { InstallDialog } from '@/components/pages/Helm/InstallDialog';
 
 export function HelmPage() {
   const selectedNamespace = useSelectedNamespacesState();
@@ -26,11 +26,13 @@ export function HelmPage() {
   const [searchQuery, setSearchQuery] = useState('');
   const loading = useloadingState();
   const { listen } = useWS();
-  const { serverInfo } = useConfig();
 
-  const listenEvents = async () => {
+  const listenEvents = async (subs: Awaited<ReturnType<typeof getCharts>>) => {
+    if (!subs) {
+      return;
+    }
     addSubscription(
-      await listen(`helm-release-${serverInfo?.server}-added`, (payload: any) => {
+      await listen(subs.added, (payload: any) => {
         helmCharts.set((prev) => {
           const newMap = new Map(prev);
           newMap.set(`${payload.namespace}-${payload.name}` as string, payload);
@@ -40,7 +42,7 @@ export function HelmPage() {
     );
 
     addSubscription(
-      await listen(`helm-release-${serverInfo?.server}-deleted`, (payload: any) => {
+      await listen(subs.deleted, (payload: any) => {
         helmCharts.set((prev) => {
           const newMap = new Map(prev);
           newMap.delete(`${payload.namespace}-${payload.name}` as string);
@@ -50,7 +52,7 @@ export function HelmPage() {
     );
 
     addSubscription(
-      await listen(`helm-release-${serverInfo?.server}-updated`, (payload: any) => {
+      await listen(subs.updated, (payload: any) => {
         helmCharts.set((prev) => {
           const newMap = new Map(prev);
           newMap.set(`${payload.namespace}-${payload.name}` as string, payload);
@@ -63,7 +65,7 @@ export function HelmPage() {
   const fetchData = useCallback(async () => {
     try {
       await call<any[]>('ping');
-      await getCharts(namespacesArray);
+      listenEvents(await getCharts(namespacesArray));
     } catch (error: any) {
       toast.error('Error! Cant ping server\n' + error.message);
     }
@@ -71,7 +73,6 @@ export function HelmPage() {
 
   useEffect(() => {
     fetchData();
-    listenEvents();
   }, [fetchData]);
   const data = Array.from(helmCharts.get().values())
     .filter(
@@ -90,6 +91,9 @@ export function HelmPage() {
   return (
     <div className="flex-grow overflow-auto">
       {<Header setSearchQuery={setSearchQuery} withNsSelector={true} />}
+      <div className="flex justify-end p-1">
+        <InstallDialog />
+      </div>
 
       <div className="grid grid-cols-1">
         <div className="h-24 col-span-2">
@@ -0,0 +1,186 @@
+import { useEffect, useState } from 'react';
+import { PackagePlus } from 'lucide-react';
+import { toast } from 'sonner';
+import {
+  Dialog,
+  DialogContent,
+  DialogHeader,
+  DialogTitle,
+  DialogDescription,
+} from '@/components/ui/dialog';
+import { Button } from '@/components/ui/button';
+import { Checkbox } from '@/components/ui/checkbox';
+import { Input } from '@/components/ui/input';
+import {
+  Select,
+  SelectContent,
+  SelectItem,
+  SelectTrigger,
+  SelectValue,
+} from '@/components/ui/select';
+import { call, upload } from '@/lib/api';
+import { useWS } from '@/context/WsContext';
+
+type LocalChart = {
+  chart: string;
+  name: string;
+  version: string;
+  app_version: string;
+  description: string;
+  source: string;
+};
+
+// InstallDialog installs a chart of the charts directory of the server or
+// an uploaded archive, the dry run shows the rendered manifests first.
+export function InstallDialog() {
+  const [open, setOpen] = useState(false);
+  const [charts, setCharts] = useState<LocalChart[]>([]);
+  const [chart, setChart] = useState('');
+  const [archive, setArchive] = useState<File | undefined>();
+  const [name, setName] = useState('');
+  const [namespace, setNamespace] = useState('default');
+  const [values, setValues] = useState('');
+  const [createNamespace, setCreateNamespace] = useState(false);
+  const [manifest, setManifest] = useState('');
+  const { listen } = useWS();
+
+  useEffect(() => {
+    if (!open) return;
+    call('helm_local_charts', {}).then((res) => {
+      if (res.message) {
+        toast.error(`Cant list the charts\n${res.message}`);
+        return;
+      }
+      setCharts(res);
+    });
+  }, [open]);
+
+  const form = (dryRun: boolean) => {
+    const form = new FormData();
+    const selected = charts.find((c) => `${c.chart}@${c.version}` === chart);
+    if (archive) {
+      form.set('archive', archive);
+    } else if (selected) {
+      form.set('chart', selected.chart);
+      form.set('version', selected.version);
+    }
+    form.set('name', name);
+    form.set('namespace', namespace);
+    form.set('values', values);
+    form.set('create_namespace', String(createNamespace));
+    form.set('dry_run', String(dryRun));
+    return form;
+  };
+
+  const dryRun = async () => {
+    const res = await upload('helm_install', form(true));
+    if (res.message) {
+      toast.error(`Cant render ${name}\n${res.message}`);
+      return;
+    }
+    setManifest(res.manifest);
+  };
+
+  const install = async () => {
+    const res = await upload('helm_install', form(false));
+    if (res.message) {
+      toast.error(`Cant install ${name}\n${res.message}`);
+      return;
+    }
+    setOpen(false);
+    setManifest('');
+    const id = toast.loading(`install ${name}...`);
+    const unlisten = await listen(res, (p: any) => {
+      if (p.operation !== 'install' || p.status === 'running') return;
+      unlisten();
+      if (p.status === 'failed') {
+        toast.error(`Cant install ${name}\n${p.message}`, { id });
+        return;
+      }
+      toast.success(`${name} installed`, { id });
+    });
+  };
+
+  return (
+    <>
+      <Button className="text-xs" size="sm" variant="outline" onClick={() => setOpen(true)}>
+        <PackagePlus size={14} /> Install
+      </Button>
+      <Dialog open={open} onOpenChange={setOpen}>
+        <DialogContent className="max-w-4xl">
+          <DialogHeader>
+            <DialogTitle className="text-xs">Install a chart</DialogTitle>
+            <DialogDescription className="text-xs">
+              A chart of the charts directory or an uploaded .tgz archive.
+            </DialogDescription>
+          </DialogHeader>
+          <div className="flex gap-2">
+            <Select onValueChange={(v) => setChart(v)} value={chart}>
+              <SelectTrigger size="sm" className="w-1/2 text-xs">
+                <SelectValue placeholder="Local chart" />
+              </SelectTrigger>
+              <SelectContent>
+                {charts.map((c) => (
+                  <SelectItem
+                    className="text-xs"
+                    key={`${c.source}-${c.chart}-${c.version}`}
+                    value={`${c.chart}@${c.version}`}
+                  >
+                    {c.name} {c.version} ({c.source})
+                  </SelectItem>
+                ))}
+              </SelectContent>
+            </Select>
+            <Input
+              type="file"
+              accept=".tgz,.tar.gz"
+              className="w-1/2 text-xs"
+              onChange={(e) => setArchive(e.target.files?.[0])}
+            />
+          </div>
+          <div className="flex gap-2">
+            <Input
+              value={name}
+              onChange={(e) => setName(e.target.value)}
+              placeholder="Release name"
+              className="text-xs"
+            />
+            <Input
+              value={namespace}
+              onChange={(e) => setNamespace(e.target.value)}
+              placeholder="Namespace"
+              className="text-xs"
+            />
+          </div>
+          <label className="flex items-center gap-2 text-xs">
+            <Checkbox
+              checked={createNamespace}
+              onCheckedChange={(v) => setCreateNamespace(v === true)}
+            />
+            Create the namespace
+          </label>
+          <textarea
+            className="h-40 w-full border rounded p-2 font-mono text-xs"
+            placeholder="values.yaml"
+            value={values}
+            onChange={(e) => setValues(e.target.value)}
+          />
+          {manifest && (
+            <pre className="h-64 overflow-auto border rounded p-2 text-xs">{manifest}</pre>
+          )}
+          <div className="flex justify-end gap-2">
+            <Button className="text-xs" onClick={() => setOpen(false)} variant="outline">
+              Cancel
+            </Button>
+            <Button className="text-xs" variant="outline" onClick={dryRun}>
+              Dry run
+            </Button>
+            <Button className="text-xs" onClick={install}>
+              Install
+            </Button>
+          </div>
+        </DialogContent>
+      </Dialog>
+    </>
+  );
+}
@@ -0,0 +1,271 @@
+import { useState } from 'react';
+import { EllipsisVertical, ArrowUpCircle, History, Trash } from 'lucide-react';
+import yaml from 'js-yaml';
+import { toast } from 'sonner';
+import {
+  DropdownMenu,
+  DropdownMenuContent,
+  DropdownMenuItem,
+  DropdownMenuTrigger,
+} from '@/components/ui/dropdown-menu';
+import {
+  Dialog,
+  DialogContent,
+  DialogHeader,
+  DialogTitle,
+  DialogDescription,
+} from '@/components/ui/dialog';
+import { Button } from '@/components/ui/button';
+import { Checkbox } from '@/components/ui/checkbox';
+import { call } from '@/lib/api';
+import { useWS } from '@/context/WsContext';
+import type { HelmRelease } from '@/types';
+
+type Revision = {
+  revision: number;
+  updated: string;
+  status: string;
+  chart: string;
+  app_version: string;
+  description: string;
+};
+
+type Diff = {
+  from: number;
+  to: number;
+  values: string;
+  computed_values: string;
+  objects: { kind: string; namespace?: string; name: string; change: string; diff: string }[];
+};
+
+type Dialogs = '' | 'upgrade' | 'rollback' | 'uninstall';
+
+// DiffView shows the values and the changed objects of a diff.
+function DiffView({ diff }: { diff: Diff }) {
+  return (
+    <div className="max-h-96 overflow-auto border rounded p-2 text-xs font-mono">
+      <div className="font-bold">values</div>
+      <pre>{diff.values || 'unchanged'}</pre>
+      <div className="font-bold pt-2">computed values</div>
+      <pre>{diff.computed_values || 'unchanged'}</pre>
+      {diff.objects.map((o) => (
+        <div key={`${o.kind}-${o.namespace}-${o.name}`} className="pt-2">
+          <div className="font-bold">
+            {o.kind} {o.namespace ? `${o.namespace}/` : ''}
+            {o.name} <i>{o.change}</i>
+          </div>
+          <pre>{o.diff}</pre>
+        </div>
+      ))}
+    </div>
+  );
+}
+
+// ReleaseActions runs the helm operations of a release, they run on the
+// server and report their progress over the websocket.
+export function ReleaseActions({ release }: { release: HelmRelease }) {
+  const [open, setOpen] = useState<Dialogs>('');
+  const [revisions, setRevisions] = useState<Revision[]>([]);
+  const [values, setValues] = useState('');
+  const [reuseValues, setReuseValues] = useState(false);
+  const [keepHistory, setKeepHistory] = useState(false);
+  const [wait, setWait] = useState(false);
+  const [diff, setDiff] = useState<Diff | undefined>();
+  const { listen } = useWS();
+
+  const run = async (operation: string, payload: Record<string, unknown>) => {
+    setOpen('');
+    const res = await call(`helm_${operation}`, {
+      name: release.name,
+      namespace: release.namespace,
+      wait: wait,
+      ...payload,
+    });
+    if (res.message) {
+      toast.error(`Cant ${operation} ${release.name}\n${res.message}`);
+      return;
+    }
+    const id = toast.loading(`${operation} ${release.name}...`);
+    const unlisten = await listen(res, (p: any) => {
+      if (p.operation !== operation) return;
+      if (p.status === 'running') {
+        toast.loading(`${operation} ${release.name}: ${p.message}`, { id });
+        return;
+      }
+      unlisten();
+      if (p.status === 'failed') {
+        toast.error(`Cant ${operation} ${release.name}\n${p.message}`, { id });
+        return;
+      }
+      toast.success(`${operation} ${release.name} done, revision ${p.revision}`, { id });
+    });
+  };
+
+  const loadDiff = async (payload: Record<string, unknown>) => {
+    const res = await call('helm_diff', {
+      name: release.name,
+      namespace: release.namespace,
+      ...payload,
+    });
+    if (res.message) {
+      toast.error(`Cant diff ${release.name}\n${res.message}`);
+      return;
+    }
+    setDiff(res);
+  };
+
+  const openRollback = async () => {
+    const res = await call('helm_history', { name: release.name, namespace: release.namespace });
+    if (res.message) {
+      toast.error(`Cant get the history of ${release.name}\n${res.message}`);
+      return;
+    }
+    setRevisions(res);
+    setDiff(undefined);
+    setOpen('rollback');
+  };
+
+  const openUpgrade = () => {
+    setValues(release.config ? yaml.dump(release.config) : '');
+    setDiff(undefined);
+    setOpen('upgrade');
+  };
+
+  const waitOption = (
+    <label className="flex items-center gap-2 text-xs">
+      <Checkbox checked={wait} onCheckedChange={(v) => setWait(v === true)} />
+      Wait for the resources to be ready
+    </label>
+  );
+
+  return (
+    <>
+      <DropdownMenu>
+        <DropdownMenuTrigger asChild>
+          <Button variant="ghost" size="sm" className="h-6 w-6 p-0">
+            <EllipsisVertical size={14} />
+          </Button>
+        </DropdownMenuTrigger>
+        <DropdownMenuContent>
+          <DropdownMenuItem className="text-xs" onClick={openUpgrade}>
+            <ArrowUpCircle size={8} /> Upgrade
+          </DropdownMenuItem>
+          <DropdownMenuItem className="text-xs" onClick={openRollback}>
+            <History size={8} /> Rollback
+          </DropdownMenuItem>
+          <DropdownMenuItem className="text-xs" onClick={() => setOpen('uninstall')}>
+            <Trash size={8} /> Uninstall
+          </DropdownMenuItem>
+        </DropdownMenuContent>
+      </DropdownMenu>
+      <Dialog open={open === 'upgrade'} onOpenChange={() => setOpen('')}>
+        <DialogContent className="max-w-3xl">
+          <DialogHeader>
+            <DialogTitle className="text-xs">Upgrade {release.name}</DialogTitle>
+            <DialogDescription className="text-xs">
+              The chart of the release is upgraded with these values.
+            </DialogDescription>
+          </DialogHeader>
+          <textarea
+            className="h-96 w-full border rounded p-2 font-mono text-xs"
+            value={values}
+            onChange={(e) => setValues(e.target.value)}
+          />
+          <label className="flex items-center gap-2 text-xs">
+            <Checkbox checked={reuseValues} onCheckedChange={(v) => setReuseValues(v === true)} />
+            Merge over the values of the release
+          </label>
+          {waitOption}
+          {diff && <DiffView diff={diff} />}
+          <div className="flex justify-end gap-2">
+            <Button className="text-xs" onClick={() => setOpen('')} variant="outline">
+              Cancel
+            </Button>
+            <Button
+              className="text-xs"
+              variant="outline"
+              onClick={() => loadDiff({ values: values, reuse_values: reuseValues })}
+            >
+              Diff
+            </Button>
+            <Button
+              className="text-xs"
+              onClick={() => run('upgrade', { values: values, reuse_values: reuseValues })}
+            >
+              Upgrade
+            </Button>
+          </div>
+        </DialogContent>
+      </Dialog>
+      <Dialog open={open === 'rollback'} onOpenChange={() => setOpen('')}>
+        <DialogContent>
+          <DialogHeader>
+            <DialogTitle className="text-xs">Rollback {release.name}</DialogTitle>
+            <DialogDescription></DialogDescription>
+          </DialogHeader>
+          <ul className="text-xs">
+            {revisions.map((r) => (
+              <li key={r.revision} className="flex items-center justify-between gap-2 py-1">
+                <span>
+                  <b>{r.revision}</b> {r.chart} {r.app_version} <i>{r.status}</i> {r.description}
+                </span>
+                {r.revision !== release.version && (
+                  <div className="flex gap-1">
+                    <Button
+                      className="text-xs"
+                      size="sm"
+                      variant="outline"
+                      onClick={() => loadDiff({ from: r.revision, to: release.version })}
+                    >
+                      Diff
+                    </Button>
+                    <Button
+                      className="text-xs"
+                      size="sm"
+                      variant="destructive"
+                      onClick={() => run('rollback', { revision: r.revision })}
+                    >
+                      Rollback
+                    </Button>
+                  </div>
+                )}
+              </li>
+            ))}
+          </ul>
+          {diff && <DiffView diff={diff} />}
+          {waitOption}
+        </DialogContent>
+      </Dialog>
+      <Dialog open={open === 'uninstall'} onOpenChange={() => setOpen('')}>
+        <DialogContent>
+          <DialogHeader>
+            <DialogTitle className="text-xs">
+              <div>Uninstall {release.name}</div>
+              <div className="pt-4 text-xs text-red-600 font-bold">
+                Every resource of the release is deleted!
+              </div>
+            </DialogTitle>
+            <DialogDescription></DialogDescription>
+          </DialogHeader>
+          <label className="flex items-center gap-2 text-xs">
+            <Checkbox checked={keepHistory} onCheckedChange={(v) => setKeepHistory(v === true)} />
+            Keep the history, the release can be rolled back
+          </label>
+          {waitOption}
+          <div className="flex justify-end gap-2">
+            <Button className="text-xs" onClick={() => setOpen('')} variant="outline">
+              Cancel
+            </Button>
+            <Button
+              className="text-xs"
+              variant="destructive"
+              onClick={() => run('uninstall', { keep_history: keepHistory })}
+            >
+              Uninstall
+            </Button>
+          </div>
+        </DialogContent>
+      </Dialog>
+    </>
+  );
+}
@@ -4,6 +4,7 @@ import { HelmRelease } from '@/types';
 import { Tooltip, TooltipContent, TooltipTrigger } from '@/components/ui/tooltip';
 import { Info } from 'lucide-react';
 import { Fragment } from 'react';
+import { ReleaseActions } from '@/components/pages/Helm/ReleaseActions';
 
 const columns: ColumnDef<HelmRelease>[] = [
   {
@@ -93,6 +94,13 @@ const columns: ColumnDef<HelmRelease>[] = [
       return <AgeCell age={(row.original as HelmRelease).info.last_deployed} />;
     },
   },
+  {
+    id: 'actions',
+    header: '',
+    cell: ({ row }) => {
+      return <ReleaseActions release={row.original as HelmRelease} />;
+    },
+  },
 ];
 
 export default columns;
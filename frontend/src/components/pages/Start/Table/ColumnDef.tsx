@@ -1,5 +1,6 @@
 import { Unplug } from 'lucide-react';
 import { Button } from '@/components/ui/button';
+import { Badge } from '@/components/ui/badge';
 import { ColumnDef } from '@tanstack/react-table';
 import { ServerInfo } from '@/types';
 import { useNavigate } from 'react-router';
@@ -12,11 +13,35 @@ const columns: ColumnDef<ServerInfo>[] = [
   {
     accessorKey: 'server',
     id: 'server',
-    header: 'Server',
+    header: 'Name',
     cell: ({ row }) => {
       return <div>{row.original.server}</div>;
     },
   },
+  {
+    accessorKey: 'address',
+    id: 'address',
+    header: 'Server',
+    cell: ({ row }) => {
+      return <div>{row.original.address}</div>;
+    },
+  },
+  {
+    accessorKey: 'labels',
+    id: 'labels',
+    header: 'Labels',
+    cell: ({ row }) => {
+      return (
+        <div className="flex flex-wrap gap-1">
+          {Object.entries(row.original.labels || {}).map(([k, v]) => (
+            <Badge key={k} variant="outline">
+              {k}={v}
+            </Badge>
+          ))}
+        </div>
+      );
+    },
+  },
   {
     accessorKey: 'connect',
     id: 'connect',
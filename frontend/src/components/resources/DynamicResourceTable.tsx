@@ -1,4 +1,4 @@
-import { useEffect } from 'react';
+import { useRef } from 'react';
 import { PaginatedTable } from '@/components/resources/PaginatedTable';
 import { call } from '@/lib/api';
 import type { ColumnDef } from '@tanstack/react-table';
@@ -32,38 +32,46 @@ export const DynamicResourceTable = <T extends { metadata: { uid?: string } }>({
   withSearch = true,
   doubleClickDisabled = false,
 }: DynamicResourceTableProps<T>) => {
+  const { listen } = useWS();
+  const { serverInfo } = useConfig();
+  // every loaded page subscribes again, the topics are listened to once
+  const topics = useRef(new Set<string>());
+
   const subscribeEvents = async (rv: string) => {
     const apiResource = getApiResource({ kind, group });
-    await call('watch_dynamic_resource', {
+    const res = await call('watch_dynamic_resource', {
       apiResource: {
         ...apiResource,
         resource_version: rv,
       },
     });
-  };
-  const { listen } = useWS();
-  const { serverInfo } = useConfig();
-
-  const listenEvents = async () => {
-    addSubscription(
-      await listen(`${kind}-${serverInfo?.server}-deleted`, (payload: any) => {
-        setState((prev) => {
-          const newMap = new Map(prev);
-          newMap.delete(payload.metadata?.uid as string);
-          return newMap;
-        });
-      }),
-    );
-
-    addSubscription(
-      await listen(`${kind}-${serverInfo?.server}-updated`, (payload: any) => {
-        setState((prev) => {
-          const newMap = new Map(prev);
-          newMap.set(payload.metadata?.uid as string, payload);
-          return newMap;
-        });
-      }),
-    );
+    if (res.message) {
+      return;
+    }
+    if (!topics.current.has(res.deleted.topic)) {
+      topics.current.add(res.deleted.topic);
+      addSubscription(
+        await listen(res.deleted, (payload: any) => {
+          setState((prev) => {
+            const newMap = new Map(prev);
+            newMap.delete(payload.metadata?.uid as string);
+            return newMap;
+          });
+        }),
+      );
+    }
+    if (!topics.current.has(res.updated.topic)) {
+      topics.current.add(res.updated.topic);
+      addSubscription(
+        await listen(res.updated, (payload: any) => {
+          setState((prev) => {
+            const newMap = new Map(prev);
+            newMap.set(payload.metadata?.uid as string, payload);
+            return newMap;
+          });
+        }),
+      );
+    }
   };
 
   const getApiResource = ({
@@ -90,10 +98,6 @@ export const DynamicResourceTable = <T extends { metadata: { uid?: string } }>({
     });
   };
 
-  useEffect(() => {
-    listenEvents();
-  }, []);
-
   return (
     <PaginatedTable<T>
       kind={kind}
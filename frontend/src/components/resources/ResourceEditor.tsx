@@ -1,6 +1,6 @@
 import { useRef, useState, useEffect } from 'react';
-import Editor, { OnMount } from '@monaco-editor/react';
-import { Save, ArrowBigLeft, Shredder, Plus, Minus, Pencil, Map } from 'lucide-react';
+import Editor, { DiffEditor, OnMount } from '@monaco-editor/react';
+import { Save, ArrowBigLeft, Shredder, Plus, Minus, Pencil, Map, GitCompare } from 'lucide-react';
 import { Button } from '@/components/ui/button';
 import { getLocalBoolean } from '@/lib/localStorage';
 import * as monaco from 'monaco-editor';
@@ -67,6 +67,7 @@ export default function ResourceEditor() {
     }
   });
   const [stripManagedFields, setStripManagedFields] = useState(false);
+  const [diff, setDiff] = useState<{ live: string; merged: string } | null>(null);
   const [selectedFont] = useState<string>(() => {
     return (
       Fonts.find((f) => f.className === localStorage.getItem(FONT_KEY))?.label || 'Cascadia Code'
@@ -151,6 +152,38 @@ export default function ResourceEditor() {
     setOriginal(cleanedYaml!);
   };
 
+  const onDiff = async () => {
+    if (diff) {
+      setDiff(null);
+      return;
+    }
+    const value = editorRef.current?.getValue();
+    let obj = yaml.load(value);
+    if (obj?.metadata?.managedFields) {
+      delete obj.metadata.managedFields;
+    }
+    const response = await call('diff_kube_resource', {
+      namespace: obj.metadata.namespace,
+      yaml: yaml.dump(obj),
+      operation: 'update',
+    });
+    if (response.message) {
+      toast.error(<span>Cant diff resource: {response.message}</span>);
+      return;
+    }
+    if (response.diff === '') {
+      toast.info(<span>No changes</span>);
+      return;
+    }
+    const clean = (o: any) => {
+      if (o?.metadata?.managedFields) {
+        delete o.metadata.managedFields;
+      }
+      return o ? yaml.dump(o, { sortKeys: true }) : '';
+    };
+    setDiff({ live: clean(response.live), merged: clean(response.merged) });
+  };
+
   const handleToggle = () => {
     setStripManagedFields(stripManagedFields);
 
@@ -205,6 +238,14 @@ export default function ResourceEditor() {
         <Button title="save" className="text-xs bg-green-500" disabled={hasErrors} onClick={onSave}>
           <Save /> Update
         </Button>
+        <Button
+          title="diff with the live object"
+          className="text-xs bg-purple-500"
+          disabled={hasErrors}
+          onClick={onDiff}
+        >
+          <GitCompare /> {diff ? 'Edit' : 'Diff'}
+        </Button>
         {getLocalBoolean(MANAGED_FIELDS) ? (
           <></>
         ) : (
@@ -239,7 +280,24 @@ export default function ResourceEditor() {
           {namespace && namespace !== 'undefined' ? `${namespace}/${name}` : name}
         </div>
       </div>
+      {diff && (
+        <DiffEditor
+          height="90vh"
+          language="yaml"
+          original={diff.live}
+          modified={diff.merged}
+          options={{
+            readOnly: true,
+            minimap: { enabled: minimap },
+            fontFamily: selectedFont,
+            fontSize: fontSize,
+            automaticLayout: true,
+          }}
+          theme={theme === 'dark' ? 'vs-dark' : 'light'}
+        />
+      )}
       <Editor
+        className={diff ? 'hidden' : ''}
         height="90vh"
         defaultLanguage="yaml"
         path={location.pathname}
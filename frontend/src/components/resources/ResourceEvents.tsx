@@ -1,6 +1,6 @@
 import { ArrowBigLeft, Rss } from 'lucide-react';
 import { Button } from '@/components/ui/button';
-import { useEffect, useState } from 'react';
+import { useEffect, useRef, useState } from 'react';
 import { call } from '@/lib/api';
 import { useNavigate } from 'react-router-dom';
 import { useLoaderData } from 'react-router';
@@ -63,33 +63,13 @@ export function ResourceEvents() {
   let navigate = useNavigate();
   const { listen } = useWS();
 
+  // the topic comes with the first page, the next pages get the same one
+  const unlisten = useRef<(() => void) | undefined>(undefined);
+
   useEffect(() => {
-    let unlisten: (() => void) | undefined;
-    const listenEvents = async () => {
-      unlisten = await listen(`${uid}-${serverInfo?.server}-updated`, (payload: any) => {
-        if (serverInfo?.version && compareVersions(serverInfo?.version, '1.20') === 1) {
-          if (payload?.regarding?.uid === uid) {
-            setEvents((prev) => {
-              const newMap = new Map(prev);
-              newMap.set(payload.metadata?.uid as string, payload);
-              return newMap;
-            });
-          }
-        } else {
-          if (payload?.involvedObject?.uid === uid) {
-            setEvents((prev) => {
-              const newMap = new Map(prev);
-              newMap.set(payload.metadata?.uid as string, payload);
-              return newMap;
-            });
-          }
-        }
-      });
-    };
-    listenEvents();
     return () => {
-      if (unlisten) {
-        unlisten();
+      if (unlisten.current) {
+        unlisten.current();
       }
     };
   }, []);
@@ -105,13 +85,35 @@ export function ResourceEvents() {
   };
 
   const subscribeEvents = async (rv: string) => {
-    await call('watch_events_dynamic_resource', {
+    const res = await call('watch_events_dynamic_resource', {
       uid: uid,
       apiResource: {
         ...getAPIResource(),
         resource_version: rv,
       },
     });
+    if (res.message || unlisten.current) {
+      return;
+    }
+    unlisten.current = await listen(res.updated, (payload: any) => {
+      if (serverInfo?.version && compareVersions(serverInfo?.version, '1.20') === 1) {
+        if (payload?.regarding?.uid === uid) {
+          setEvents((prev) => {
+            const newMap = new Map(prev);
+            newMap.set(payload.metadata?.uid as string, payload);
+            return newMap;
+          });
+        }
+      } else {
+        if (payload?.involvedObject?.uid === uid) {
+          setEvents((prev) => {
+            const newMap = new Map(prev);
+            newMap.set(payload.metadata?.uid as string, payload);
+            return newMap;
+          });
+        }
+      }
+    });
   };
 
   const getPage = async ({ limit, continueToken }: { limit: number; continueToken?: string }) => {
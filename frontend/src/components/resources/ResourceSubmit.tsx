@@ -98,38 +98,45 @@ export default function ResourceEditor() {
       );
       return;
     }
-    let obj = yaml.load(value);
-    if (stripManagedFields && obj?.metadata?.managedFields) {
-      delete obj.metadata.managedFields;
+    const docs = yaml.loadAll(value).filter((d: any) => d);
+    if (stripManagedFields) {
+      docs.forEach((d: any) => delete d?.metadata?.managedFields);
     }
-    if (
-      (selectedNamespace.get() !== 'all' && obj.metadata.namespace === '') ||
-      obj.metadata.namespace === undefined
-    ) {
-      obj.metadata.namespace = selectedNamespace.get();
-      toast.warning(<span>Using current namespace {selectedNamespace.get()}</span>);
-    }
-    const cleanedYaml = yaml.dump(obj);
-    setOriginal(yaml.dump(obj));
+    const namespace = selectedNamespace.get() !== 'all' ? selectedNamespace.get() : '';
+    const cleanedYaml = docs.map((d: any) => yaml.dump(d)).join('---\n');
+    setOriginal(cleanedYaml);
     const response = await call('create_kube_resource', {
-      namespace: obj.metadata.namespace,
+      namespace: namespace,
       yaml: cleanedYaml,
     });
+    const items = response.items || [];
     if (response.message) {
-      toast.error(<span>Cant create resource: {response.message}</span>);
+      toast.error(
+        <div className="flex flex-col">
+          <div>Cant create resource: {response.message}</div>
+          {items
+            .filter((r: any) => r.status !== 'failed')
+            .map((r: any, i: number) => (
+              <div key={i} className="text-muted-foreground">
+                {r.status} {r.kind} {r.namespace ? `${r.namespace}/` : ''}
+                {r.name}
+              </div>
+            ))}
+        </div>,
+      );
       return;
     }
     toast.info(
-      <span>
-        Resource created:
-        <br />
-        <span className="font-bold text-muted-foreground">
-          {obj.kind} {obj.metadata.namespace ? `${obj.metadata.namespace}/` : ''}
-          {obj.metadata.name}
-        </span>
-      </span>,
+      <div className="flex flex-col">
+        <span>{items.length > 1 ? 'Resources created:' : 'Resource created:'}</span>
+        {items.map((r: any, i: number) => (
+          <span key={i} className="font-bold text-muted-foreground">
+            {r.kind} {r.namespace ? `${r.namespace}/` : ''}
+            {r.name}
+          </span>
+        ))}
+      </div>,
     );
-    setOriginal(cleanedYaml!);
   };
 
   const handleToggle = () => {
@@ -140,12 +147,11 @@ export default function ResourceEditor() {
       if (!editor) return;
 
       const raw = editor.getValue();
-      const obj = yaml.load(raw) as any;
+      const docs = yaml.loadAll(raw).filter((d: any) => d) as any[];
 
-      if (obj?.metadata?.managedFields) {
-        delete obj.metadata.managedFields;
-        const newYaml = yaml.dump(obj);
-        editor.setValue(newYaml);
+      if (docs.some((d) => d?.metadata?.managedFields)) {
+        docs.forEach((d) => delete d?.metadata?.managedFields);
+        editor.setValue(docs.map((d) => yaml.dump(d)).join('---\n'));
       }
     } catch (err) {
       toast.error('Invalid YAML');
@@ -1,8 +1,9 @@
-import { ArrowBigLeft, Scroll, ScrollText } from 'lucide-react';
+import { ArrowBigLeft, Clock, Download, History, Scroll, ScrollText } from 'lucide-react';
 import { Button } from '@/components/ui/button';
 import { Input } from '@/components/ui/input';
 import { useEffect, useRef, useState } from 'react';
 import { call } from '@/lib/api';
+import { getLocalKeyObject } from '@/lib/localStorage';
 import { toast } from 'sonner';
 import { stopLogsWatcher } from '@/lib/events';
 import { logsState, useLogsState } from '@/store/logs';
@@ -24,13 +25,19 @@ export function PodLogs() {
   const [podContainers, setPodContainers] = useState([]);
   const [currentContainer, setContainer] = useState('');
   const [autoScroll, setAutoScroll] = useState(true);
+  const [previous, setPrevious] = useState(false);
+  const [timestamps, setTimestamps] = useState(false);
   const containerRef = useRef<HTMLDivElement>(null);
   let logLines = useLogsState();
   const [filterText, setFilterText] = useState('');
+  const [grepText, setGrepText] = useState('');
+  const [include, setInclude] = useState('');
+  const [level, setLevel] = useState('all');
   const { listen } = useWS();
 
   useEffect(() => {
     let unlisten: (() => void) | undefined;
+    let topic: string | undefined;
     if (currentContainer === '') {
       let obj = yaml.load(data);
       setPodContainers(
@@ -41,39 +48,53 @@ export function PodLogs() {
       );
       setContainer(obj.spec.containers[0].name);
     }
+    const filter =
+      include !== '' || level !== 'all'
+        ? { include: include, level: level === 'all' ? '' : level, context: 2 }
+        : undefined;
     const subscribe = async () => {
       if (currentContainer === '') return;
       const logs = await call('get_pod_logs', {
         name: name,
         namespace: ns,
         container: currentContainer,
-        tailLines: 100,
+        tail_lines: 100,
+        previous: previous,
+        timestamps: timestamps,
+        filter: filter,
       });
       if (logs.message) {
-        toast.error('Error! Cant ping server\n' + logs.message);
-        navigate(-1);
+        toast.error('Error! Cant get logs\n' + logs.message);
+        return;
       }
       logLines.set(
         logs.map((l) => {
           return { c: currentContainer, l: l };
         }),
       );
-      unlisten = await listen(`pod_log_line_${name}_${ns}`, (payload: any) => {
+      // the previous container is gone, there is nothing to follow
+      if (previous) return;
+      const stream = await call('stream_pod_logs', {
+        name: name,
+        namespace: ns,
+        container: currentContainer,
+        timestamps: timestamps,
+        filter: filter,
+      });
+      if (stream.message) {
+        toast.error('Cant stream logs\n' + stream.message);
+        return;
+      }
+      topic = stream.topic;
+      unlisten = await listen(stream, (payload: any) => {
         const p = payload as {
           pod: string;
           container: string;
           namespace: string;
           line: string;
         };
-        if (name === p.pod && ns === p.namespace && p.container === currentContainer) {
-          logLines.set((prev) => [...prev, { c: p.container, l: p.line }]);
-        }
-      });
-
-      await call('stream_pod_logs', {
-        name: name,
-        namespace: ns,
-        container: currentContainer,
+        const gap = (payload as { gap?: boolean }).gap ? [{ c: p.container, l: '--' }] : [];
+        logLines.set((prev) => [...prev, ...gap, { c: p.container, l: p.line }]);
       });
     };
 
@@ -81,10 +102,9 @@ export function PodLogs() {
 
     return () => {
       if (unlisten) unlisten();
-      if (currentContainer === '') return;
-      stopLogsWatcher(name, ns, currentContainer);
+      if (topic) stopLogsWatcher(topic);
     };
-  }, [currentContainer]);
+  }, [currentContainer, previous, timestamps, include, level]);
 
   useEffect(() => {
     if (autoScroll) {
@@ -107,6 +127,22 @@ export function PodLogs() {
     return () => document.removeEventListener('keydown', down);
   }, []);
 
+  const download = () => {
+    const params = new URLSearchParams({
+      server: getLocalKeyObject('currentCluster').server,
+      namespace: ns,
+      name: name,
+      container: currentContainer,
+      previous: String(previous),
+      timestamps: String(timestamps),
+      gzip: 'true',
+      token: localStorage.getItem('token') || '',
+    });
+    const a = document.createElement('a');
+    a.href = `/api/download_pod_logs?${params}`;
+    a.click();
+  };
+
   const handleScroll = () => {
     const el = containerRef.current;
     if (!el) return;
@@ -139,6 +175,44 @@ export function PodLogs() {
             ))}
           </SelectContent>
         </Select>
+        <Button
+          title="previous container"
+          onClick={() => setPrevious((prev) => !prev)}
+          className={`text-xs ${previous ? 'bg-green-500' : 'bg-gray-500'}`}
+        >
+          <History />
+        </Button>
+        <Button
+          title="timestamps"
+          onClick={() => setTimestamps((prev) => !prev)}
+          className={`text-xs ${timestamps ? 'bg-green-500' : 'bg-gray-500'}`}
+        >
+          <Clock />
+        </Button>
+        <Button title="download" className="text-xs bg-gray-500" onClick={download}>
+          <Download />
+        </Button>
+        <Input
+          value={grepText}
+          onChange={(e) => setGrepText(e.target.value)}
+          onKeyDown={(e) => {
+            if (e.key === 'Enter') setInclude(grepText);
+          }}
+          placeholder="Server regex, Enter..."
+          className="w-1/6 text-xs"
+        />
+        <Select onValueChange={(e) => setLevel(e)} defaultValue={level}>
+          <SelectTrigger size="sm" className="w-[100px] text-xs">
+            <SelectValue placeholder={level} />
+          </SelectTrigger>
+          <SelectContent>
+            {['all', 'debug', 'info', 'warn', 'error', 'fatal'].map((l) => (
+              <SelectItem className="text-xs" key={l} value={l}>
+                {l}
+              </SelectItem>
+            ))}
+          </SelectContent>
+        </Select>
         <Input
           value={filterText}
           onChange={(e) => setFilterText(e.target.value)}
@@ -0,0 +1,133 @@
+import { ArrowBigLeft, Scroll, ScrollText } from 'lucide-react';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { useEffect, useRef, useState } from 'react';
+import { call } from '@/lib/api';
+import { toast } from 'sonner';
+import { stopLogsWatcher } from '@/lib/events';
+import { useNavigate } from 'react-router-dom';
+import { useParams } from 'react-router';
+import { useWS } from '@/context/WsContext';
+
+// lines kept in the view, the oldest ones are dropped
+const MAX_LINES = 5000;
+
+type LogLine = {
+  cluster: string;
+  namespace: string;
+  pod: string;
+  container: string;
+  line: string;
+};
+
+// WorkloadLogs follows every pod and container of a workload, new pods are
+// attached by the server as they start.
+export function WorkloadLogs() {
+  const { kind, namespace, name } = useParams();
+  let navigate = useNavigate();
+  const [lines, setLines] = useState<LogLine[]>([]);
+  const [autoScroll, setAutoScroll] = useState(true);
+  const [filterText, setFilterText] = useState('');
+  const containerRef = useRef<HTMLDivElement>(null);
+  const { listen } = useWS();
+
+  useEffect(() => {
+    let unlisten: (() => void) | undefined;
+    let topic: string | undefined;
+    const subscribe = async () => {
+      const stream = await call('stream_logs', {
+        kind: kind,
+        namespace: namespace,
+        name: name,
+        tail_lines: 10,
+      });
+      if (stream.message) {
+        toast.error('Cant stream logs\n' + stream.message);
+        return;
+      }
+      topic = stream.topic;
+      unlisten = await listen(stream, (payload: any) => {
+        setLines((prev) => [...prev.slice(-MAX_LINES + 1), payload as LogLine]);
+      });
+    };
+
+    subscribe();
+
+    return () => {
+      if (unlisten) unlisten();
+      if (topic) stopLogsWatcher(topic);
+    };
+  }, [kind, namespace, name]);
+
+  useEffect(() => {
+    if (autoScroll) {
+      const el = containerRef.current;
+      if (el) {
+        el.scrollTop = el.scrollHeight;
+      }
+    }
+  }, [lines, autoScroll]);
+
+  useEffect(() => {
+    const down = (e: KeyboardEvent) => {
+      if (e.key === 'Escape') {
+        e.preventDefault();
+        navigate(-1);
+      }
+    };
+
+    document.addEventListener('keydown', down);
+    return () => document.removeEventListener('keydown', down);
+  }, []);
+
+  const handleScroll = () => {
+    const el = containerRef.current;
+    if (!el) return;
+
+    const atBottom = el.scrollHeight - el.scrollTop - el.clientHeight < 20;
+    setAutoScroll(atBottom);
+  };
+  return (
+    <div className="h-screen flex flex-col">
+      <div className="flex gap-2 p-1 border-b justify-items-stretch items-center">
+        <Button title="back" className="text-xs bg-blue-500" onClick={() => navigate(-1)}>
+          <ArrowBigLeft /> Esc
+        </Button>
+        <Button
+          onClick={() => setAutoScroll((prev) => !prev)}
+          className={`text-xs ${autoScroll ? 'bg-gray-500' : 'bg-green-500'}`}
+        >
+          <Scroll />
+        </Button>
+        <Input
+          value={filterText}
+          onChange={(e) => setFilterText(e.target.value)}
+          placeholder="Filter..."
+          className="w-1/6 text-xs"
+        />
+        <div className="flex flex-row items-center text-xs">
+          <ScrollText className="mr-1" size={14} />
+          <span>
+            {kind} {namespace}/{name}
+          </span>
+        </div>
+      </div>
+      <div
+        ref={containerRef}
+        onScroll={handleScroll}
+        className="w-full h-screen overflow-y-auto text-xs p-0"
+      >
+        {lines
+          .filter((l) => l.line.toLowerCase().includes(filterText.toLowerCase()))
+          .map((l, i) => (
+            <div key={i}>
+              <span className="text-muted-foreground">
+                {l.pod}/{l.container}{' '}
+              </span>
+              {l.line}
+            </div>
+          ))}
+      </div>
+    </div>
+  );
+}
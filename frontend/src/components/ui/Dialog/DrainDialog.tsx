@@ -34,8 +34,15 @@ export function DrainDialog({ rows, open, setOpenDialog }: DrainDialogProps) {
 
   useEffect(() => {
     const subscribe = async () => {
+      const sub = await call('watch_drain', {
+        resourceName: obj.metadata?.name,
+        resourceUid: obj.metadata?.uid,
+      });
+      if (sub.message) {
+        return;
+      }
       addSubscription(
-        await listen(`drain_${obj.metadata.name}_${obj.metadata.uid}`, (payload: any) => {
+        await listen(sub, (payload: any) => {
           setDrainLog((prev) => [{ pod: payload.pod, ns: payload.ns }, ...prev]);
         }),
       );
@@ -0,0 +1,74 @@
+import { ContextMenuItem } from '@/components/ui/context-menu';
+import { RefreshCcw, Pause, Play, Undo2 } from 'lucide-react';
+import { toast } from 'sonner';
+import { call } from '@/lib/api';
+
+const operations = [
+  { action: 'rollout_restart', label: 'Restart', icon: RefreshCcw, done: 'restarted' },
+  { action: 'rollout_pause', label: 'Pause', icon: Pause, done: 'paused' },
+  { action: 'rollout_resume', label: 'Resume', icon: Play, done: 'resumed' },
+  { action: 'rollout_undo', label: 'Undo', icon: Undo2, done: 'rolled back' },
+];
+
+export function RolloutMenu({ key, obj }: { key: string; obj: any }) {
+  const paused = obj.spec?.paused === true;
+  return (
+    <>
+      {operations
+        .filter((op) => {
+          // only deployments can be paused, offer the one matching the state
+          if (op.action === 'rollout_pause') return obj.kind === 'Deployment' && !paused;
+          if (op.action === 'rollout_resume') return obj.kind === 'Deployment' && paused;
+          return true;
+        })
+        .map((op) => (
+          <ContextMenuItem
+            key={`${key}-${op.action}`}
+            className="text-xs"
+            onClick={() => {
+              call(op.action, {
+                kind: obj.kind,
+                namespace: obj.metadata?.namespace,
+                name: obj.metadata?.name,
+              })
+                .then((data) => {
+                  if (data.message) {
+                    toast.error(
+                      <span>
+                        Cant {op.label.toLowerCase()} {obj.metadata?.name}
+                        <br />
+                        {data.message}
+                      </span>,
+                    );
+                    return;
+                  }
+                  toast.info(
+                    <span>
+                      {obj.kind} {obj.metadata?.name} {op.done}
+                      {data.success && (
+                        <>
+                          <br />
+                          {data.success}
+                        </>
+                      )}
+                    </span>,
+                  );
+                })
+                .catch((reason) => {
+                  toast.error(
+                    <span>
+                      Cant {op.label.toLowerCase()} {obj.metadata?.name}
+                      <br />
+                      {reason.message}
+                    </span>,
+                  );
+                });
+            }}
+          >
+            <op.icon />
+            {op.label}
+          </ContextMenuItem>
+        ))}
+    </>
+  );
+}
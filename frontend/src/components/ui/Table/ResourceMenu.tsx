@@ -9,6 +9,7 @@ import { useNavigate } from 'react-router';
 import { NodeDrainMenu, NodeCordonMenu } from '@/components/ui/Table/ContextMenu/Node';
 import type { ApiResource } from '@/types';
 import { CronJobTriggerMenu } from './ContextMenu/CronJob';
+import { RolloutMenu } from './ContextMenu/Rollout';
 
 export default function ResourceMenu({
   apiResource,
@@ -70,6 +71,8 @@ export default function ResourceMenu({
         {kind === 'CronJob' && table.getSelectedRowModel().rows.length === 0 && (
           <CronJobTriggerMenu key={key} obj={obj} apiResource={apiResource} />
         )}
+        {['Deployment', 'StatefulSet', 'DaemonSet'].includes(kind) &&
+          table.getSelectedRowModel().rows.length === 0 && <RolloutMenu key={key} obj={obj} />}
         {table.getSelectedRowModel().rows.length === 0 && (
           <ContextMenuItem
             key={`${key}-${Math.random()}`}
@@ -102,6 +105,22 @@ export default function ResourceMenu({
             </div>
           </ContextMenuItem>
         )}
+        {['Deployment', 'StatefulSet', 'DaemonSet', 'ReplicaSet', 'Job'].includes(kind) &&
+          table.getSelectedRowModel().rows.length === 0 && (
+            <ContextMenuItem
+              key={`${key}-${Math.random()}`}
+              className="text-xs"
+              onClick={() =>
+                navigate(
+                  `/resource/WorkloadLogs/${kind}/${obj?.metadata?.namespace}/${obj?.metadata?.name}`,
+                )
+              }
+            >
+              <div className="flex flex-row">
+                <ScrollText size={8} /> <span className="ml-2">Logs</span>
+              </div>
+            </ContextMenuItem>
+          )}
         {(kind === 'Deployment' || kind === 'ReplicaSet') && (
           <ContextMenuItem
             key={`${key}-${Math.random()}`}
@@ -12,6 +12,7 @@ type AuthContextType = {
   logout: () => void;
   isAuthenticated: boolean;
   AuthDisabled: boolean;
+  OIDCEnabled: boolean;
 };
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined);
@@ -20,6 +21,7 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
   const [user, setUser] = useState<User | null>(null);
   const [token, setToken] = useState<string | null>(null);
   const [authDisabled, setAuthDisabled] = useState<boolean | null>(null);
+  const [oidcEnabled, setOIDCEnabled] = useState<boolean>(false);
 
   const fetchAuthData = useCallback(async () => {
     try {
@@ -28,14 +30,36 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
       });
       const data: any = await res.json();
       setAuthDisabled(data.message);
+      const oidcRes: any = await fetch('/api/oidc_enabled', {
+        headers: { 'Content-Type': 'application/json' },
+      });
+      const oidcData: any = await oidcRes.json();
+      setOIDCEnabled(!!oidcData.message);
     } catch (error: any) {
       setAuthDisabled(true);
       console.error(error);
     }
   }, [authDisabled]);
 
+  const storeToken = (token: string) => {
+    const payload = JSON.parse(atob(token.split('.')[1]));
+    const user: User = { username: payload.username, role: payload.role };
+
+    setToken(token);
+    setUser(user);
+    localStorage.setItem('token', token);
+    localStorage.setItem('user', JSON.stringify(user));
+  };
+
   useEffect(() => {
     fetchAuthData();
+    // the oidc callback redirects with the token in the url fragment
+    const hashToken = new URLSearchParams(location.hash.slice(1)).get('token');
+    if (hashToken) {
+      history.replaceState(null, '', location.pathname + location.search);
+      storeToken(hashToken);
+      return;
+    }
     const storedToken = localStorage.getItem('token');
     const storedUser = localStorage.getItem('user');
     if (storedToken && storedUser) {
@@ -56,20 +80,19 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
     }
 
     const data = await res.json();
-    const { token } = data;
-
-    const payload = JSON.parse(atob(token.split('.')[1]));
-    const user: User = { username: payload.username, role: payload.role };
-
-    setToken(token);
-    setUser(user);
-    localStorage.setItem('token', token);
-    localStorage.setItem('user', JSON.stringify(user));
+    storeToken(data.token);
 
     return { success: '' };
   };
 
   const logout = () => {
+    // stops the server side resources of the session, like the port forwards
+    const current = localStorage.getItem('token');
+    fetch('/api/logout', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', Token: current ? current : '' },
+      body: '{}',
+    }).catch(() => {});
     setToken(null);
     setUser(null);
     localStorage.removeItem('token');
@@ -78,7 +101,15 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
 
   return (
     <AuthContext.Provider
-      value={{ user, token, login, logout, isAuthenticated: !!token, AuthDisabled: !!authDisabled }}
+      value={{
+        user,
+        token,
+        login,
+        logout,
+        isAuthenticated: !!token,
+        AuthDisabled: !!authDisabled,
+        OIDCEnabled: oidcEnabled,
+      }}
     >
       {children}
     </AuthContext.Provider>
@@ -97,7 +97,14 @@ async function fetchAndWatchCRDs(
   const resource = (apiResources || []).find(
     (r: ApiResource) => r.kind === 'CustomResourceDefinition',
   );
-  await call('watch_dynamic_resource', { server, request: { ...resource, resource_version: rv } });
+  const watch = await call('watch_dynamic_resource', {
+    server,
+    apiResource: { ...resource, resource_version: rv },
+  });
+  if (watch.message) {
+    toast.error(<div>Cant watch CRD Resources: {watch.message}</div>);
+    return;
+  }
   resources
     .filter((x) => x.kind !== 'SelfSubjectReview')
     .forEach((x) => {
@@ -108,7 +115,9 @@ async function fetchAndWatchCRDs(
       });
     });
   addSubscription(
-    listen(`CustomResourceDefinition-${server}-deleted`, async (ev: any) => {
+    listen(watch.deleted, async (ev: any) => {
+      // the kinds of the deleted CRD are still cached by the server
+      call('invalidate_discovery', { server });
       fetchAndWatchCRs(listen, server, ev.spec.names.kind, ev.spec.group, apiResources);
       crdsState.set((prev) => {
         const newMap = new Map(prev);
@@ -118,7 +127,7 @@ async function fetchAndWatchCRDs(
     }),
   );
   addSubscription(
-    listen(`CustomResourceDefinition-${server}-updated`, async (ev: any) => {
+    listen(watch.updated, async (ev: any) => {
       fetchAndWatchCRs(listen, server, ev.spec.names.kind, ev.spec.group, apiResources);
       crdsState.set((prev) => {
         const newMap = new Map(prev);
@@ -156,12 +165,15 @@ async function fetchAndWatchCRs(
   if (kind === 'ComponentStatus') {
     return;
   }
-  await call('watch_dynamic_resource', {
+  const watch = await call('watch_dynamic_resource', {
     server,
     apiResource: { ...customResource, resource_version: rv },
   });
+  if (watch.message) {
+    return;
+  }
   addSubscription(
-    listen(`${kind}-${server}-deleted`, (ev: any) => {
+    listen(watch.deleted, (ev: any) => {
       crsState.set((prev) => {
         const newMap = new Map(prev);
         newMap.delete(ev.metadata.uid);
@@ -170,7 +182,7 @@ async function fetchAndWatchCRs(
     }),
   );
   addSubscription(
-    listen(`${kind}-${server}-updated`, (ev: any) => {
+    listen(watch.updated, (ev: any) => {
       crsState.set((prev) => {
         const newMap = new Map(prev);
         newMap.set(ev.metadata.uid, ev);
@@ -203,15 +215,18 @@ async function fetchAndWatchNamespaces(
       return newMap;
     });
   });
-  await call('watch_dynamic_resource', {
+  const watch = await call('watch_dynamic_resource', {
     server,
     apiResource: {
       ...nsResource,
       resource_version: rv,
     },
   });
+  if (watch.message) {
+    return;
+  }
   addSubscription(
-    listen(`Namespace-${server}-deleted`, async (ev: any) => {
+    listen(watch.deleted, async (ev: any) => {
       namespacesState.set((prev) => {
         const newMap = new Map(prev);
         newMap.delete(ev.metadata?.uid as string);
@@ -220,7 +235,7 @@ async function fetchAndWatchNamespaces(
     }),
   );
   addSubscription(
-    listen(`Namespace-${server}-updated`, async (ev: any) => {
+    listen(watch.updated, async (ev: any) => {
       namespacesState.set((prev) => {
         const newMap = new Map(prev);
         newMap.set(ev.metadata?.uid as string, ev);
@@ -1,9 +1,16 @@
 import React, { createContext, useContext, useEffect, useRef, useState } from 'react';
 import ReconnectingWebSocket from 'reconnecting-websocket';
 
+// Subscription is handed out by the endpoints, the token is signed by the
+// server for the user and the topic.
+export type Subscription = {
+  topic: string;
+  token: string;
+};
+
 type WSContextType = {
   send: (event: string, payload: any) => void;
-  listen: <T>(event: string, handler: (payload: T) => void) => () => void;
+  listen: <T>(sub: Subscription, handler: (payload: T) => void) => () => void;
 };
 
 const WSContext = createContext<WSContextType | null>(null);
@@ -11,13 +18,31 @@ const WSContext = createContext<WSContextType | null>(null);
 export const WSProvider: React.FC<{ children: React.ReactNode }> = ({ children }) => {
   const wsRef = useRef<ReconnectingWebSocket | null>(null);
   const [listeners] = useState<Record<string, ((payload: any) => void)[]>>({});
+  const tokens = useRef<Record<string, string>>({});
 
   useEffect(() => {
     const wsserverurl = `${location.hostname}:${location.port}`;
-    const ws = new ReconnectingWebSocket(`ws://${wsserverurl}/ws`);
+    // resolve the url on every reconnect to pick up a refreshed token
+    const ws = new ReconnectingWebSocket(() => {
+      const token = localStorage.getItem('token') || '';
+      return `ws://${wsserverurl}/ws?token=${encodeURIComponent(token)}`;
+    });
     wsRef.current = ws;
 
-    ws.addEventListener('open', () => console.debug('WS connected'));
+    ws.addEventListener('open', () => {
+      console.debug('WS connected');
+      // the server forgets subscriptions on disconnect, restore them
+      Object.keys(listeners)
+        .filter((ev) => listeners[ev].length > 0)
+        .forEach((ev) =>
+          ws.send(
+            JSON.stringify({
+              event: 'subscribe',
+              payload: { topic: ev, token: tokens.current[ev] },
+            }),
+          ),
+        );
+    });
     ws.addEventListener('close', () => console.debug('WS disconnected'));
 
     ws.addEventListener('message', (event) => {
@@ -38,12 +63,16 @@ export const WSProvider: React.FC<{ children: React.ReactNode }> = ({ children }
     wsRef.current?.send(JSON.stringify({ event, payload }));
   };
 
-  const listen = <T,>(event: string, handler: (payload: T) => void) => {
+  const listen = <T,>(sub: Subscription, handler: (payload: T) => void) => {
+    const event = sub.topic;
+    tokens.current[event] = sub.token;
     if (!listeners[event]) listeners[event] = [];
+    if (listeners[event].length === 0) send('subscribe', sub);
     listeners[event].push(handler);
 
     return () => {
       listeners[event] = listeners[event].filter((h) => h !== handler);
+      if (listeners[event].length === 0) send('unsubscribe', { topic: event });
     };
   };
 
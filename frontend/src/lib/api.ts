@@ -47,16 +47,19 @@ export async function call<T = any>(action: string, payload?: InvokePayload): Pr
   return res.json();
 }
 
-export async function cleanup() {
+// upload posts a multipart form, the server of the current cluster is added
+export async function upload<T = any>(action: string, form: FormData): Promise<T | any> {
   const config = getLocalKeyObject('currentCluster');
+  if (config.hasOwnProperty('server') && config.server !== '') {
+    form.set('server', config.server);
+  }
   const token = localStorage.getItem('token');
-  const server = config.server;
-  await fetch(`/api/cleanup`, {
+  const res = await fetch(`/api/${action}`, {
     method: 'POST',
     headers: {
-      'Content-Type': 'application/json',
       Token: token ? token : '',
     },
-    body: JSON.stringify({ server }),
+    body: form,
   });
+  return res.json();
 }
@@ -6,6 +6,7 @@ import { ResourceEvents } from '@/components/resources/ResourceEvents';
 import Deployments from '@/components/resources/Workloads/Deployments';
 import DaemonSets from '@/components/resources/Workloads/DaemonSets';
 import { PodLogs } from '@/components/resources/Workloads/PodLogs';
+import { WorkloadLogs } from '@/components/resources/Workloads/WorkloadLogs';
 import ReplicaSets from '@/components/resources/Workloads/ReplicaSets';
 import StatefulSets from '@/components/resources/Workloads/StatefulSets';
 import Jobs from '@/components/resources/Workloads/Jobs';
@@ -93,6 +94,11 @@ export const router = createBrowserRouter([
         element: <PodLogs />,
         errorElement: <ErrorPage />,
       },
+      {
+        path: '/resource/WorkloadLogs/:kind/:namespace/:name',
+        element: <WorkloadLogs />,
+        errorElement: <ErrorPage />,
+      },
       {
         path: '/resource/ReplicaSet',
         element: <ReplicaSets />,
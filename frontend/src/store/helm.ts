@@ -2,12 +2,17 @@ import { hookstate, useHookstate } from '@hookstate/core';
 import { toast } from 'sonner';
 import { call } from '@/lib/api';
 import { HelmRelease } from '@/types';
+import type { Subscription } from '@/context/WsContext';
 
 export const helmState = hookstate<Map<string, HelmRelease>>(new Map());
 
-export async function getCharts(namespaces: string[]) {
+// getCharts returns the subscriptions to the release events, undefined when
+// the releases cant be listed.
+export async function getCharts(
+  namespaces: string[],
+): Promise<{ added: Subscription; updated: Subscription; deleted: Subscription } | undefined> {
   try {
-    let { charts } = await call<any[]>('helm_releases', {
+    let { charts, added, updated, deleted } = await call<any>('helm_releases', {
       namespaces: namespaces,
     });
     (charts || []).forEach((chart: HelmRelease) => {
@@ -15,6 +20,7 @@ export async function getCharts(namespaces: string[]) {
       newMap.set(`${chart.namespace}-${chart.name}`, chart);
       helmState.set(newMap);
     });
+    return added && { added, updated, deleted };
   } catch (error: any) {
     toast.error('Error! Cant load helm charts\n' + error.message);
     console.error('Error! Cant load helm charts\n' + error.message);
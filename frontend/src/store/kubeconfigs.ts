@@ -9,9 +9,12 @@ export async function getConfigs(query: string) {
   let configs = await call<any[]>('lookup_configs');
   if (query !== '') {
     configs = configs.filter((c) => {
-      return String(c.server || '')
-        .toLowerCase()
-        .includes(query.toLowerCase());
+      const labels = Object.entries(c.labels || {}).map(([k, v]) => `${k}=${v}`);
+      return [c.server, c.address, ...labels].some((v) =>
+        String(v || '')
+          .toLowerCase()
+          .includes(query.toLowerCase()),
+      );
     });
   }
   kubeConfigsState.configs.set(configs);
@@ -1,6 +1,8 @@
 type ServerInfo = {
   version: string;
   server?: string;
+  address?: string;
+  labels?: Record<string, string>;
   apiResources?: ApiResource[];
 };
 
@@ -19,6 +21,7 @@ type HelmRelease = {
     status: string;
   };
   version: number;
+  config?: Record<string, any>;
 };
 
 type ApiResource = {
@@ -0,0 +1,327 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"teleskopio/pkg/config"
+)
+
+const (
+	Success = "success"
+	Failure = "failure"
+	Denied  = "denied"
+
+	memoryEntries  = 1000
+	defaultLimit   = 100
+	webhookTimeout = 5 * time.Second
+	webhookQueue   = 1000
+)
+
+// Entry is a single mutating operation, Payload holds the request data, e.g.
+// the new replicas count. Manifests are recorded by their Digest and the
+// kind, namespace and name of their objects, they may hold Secret data.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Role      string    `json:"role"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Operation string    `json:"operation"`
+	Payload   any       `json:"payload,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Filter - empty fields match anything.
+type Filter struct {
+	User      string    `form:"user"`
+	Cluster   string    `form:"cluster"`
+	Namespace string    `form:"namespace"`
+	Kind      string    `form:"kind"`
+	Operation string    `form:"operation"`
+	Outcome   string    `form:"outcome"`
+	Since     time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until     time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit     int       `form:"limit"`
+}
+
+func (f Filter) Match(e Entry) bool {
+	return (f.User == "" || f.User == e.User) &&
+		(f.Cluster == "" || f.Cluster == e.Cluster) &&
+		(f.Namespace == "" || f.Namespace == e.Namespace) &&
+		(f.Kind == "" || f.Kind == e.Kind) &&
+		(f.Operation == "" || f.Operation == e.Operation) &&
+		(f.Outcome == "" || f.Outcome == e.Outcome) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+type Sink interface {
+	Write(e Entry) error
+}
+
+// Querier is a sink able to read the entries back.
+type Querier interface {
+	Query(f Filter) ([]Entry, error)
+}
+
+type Logger struct {
+	enabled bool
+	sinks   []Sink
+	querier Querier
+}
+
+// New - the entries are queried from the file when it's set, otherwise the
+// last entries are kept in memory.
+func New(cfg config.Audit) (*Logger, error) {
+	l := &Logger{enabled: cfg.Enabled}
+	if !cfg.Enabled {
+		return l, nil
+	}
+	if cfg.File != "" {
+		f, err := NewFileSink(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		l.sinks = append(l.sinks, f)
+		l.querier = f
+	} else {
+		m := NewMemorySink(memoryEntries)
+		l.sinks = append(l.sinks, m)
+		l.querier = m
+	}
+	if cfg.Stdout {
+		l.sinks = append(l.sinks, NewWriterSink(os.Stdout))
+	}
+	if cfg.Webhook.URL != "" {
+		l.sinks = append(l.sinks, NewWebhookSink(cfg.Webhook.URL, cfg.Webhook.Headers))
+	}
+	return l, nil
+}
+
+// Digest identifies a manifest without recording it.
+func Digest(manifest string) string {
+	sum := sha256.Sum256([]byte(manifest))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (l *Logger) Enabled() bool {
+	return l.enabled
+}
+
+func (l *Logger) Record(e Entry) {
+	if !l.enabled {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	for _, s := range l.sinks {
+		if err := s.Write(e); err != nil {
+			slog.Error("audit sink", "err", err.Error(), "user", e.User, "operation", e.Operation)
+		}
+	}
+}
+
+// Query returns the newest entries matching the filter first.
+func (l *Logger) Query(f Filter) ([]Entry, error) {
+	if !l.enabled {
+		return []Entry{}, nil
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultLimit
+	}
+	return l.querier.Query(f)
+}
+
+// newest keeps the last limit entries of the chronological list in reverse order.
+func newest(entries []Entry, limit int) []Entry {
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	slices.Reverse(entries)
+	return entries
+}
+
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// NewFileSink appends JSON lines to the file.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit file: %w", err)
+	}
+	return &FileSink{path: path, f: f}, nil
+}
+
+func (s *FileSink) Write(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *FileSink) Query(f Filter) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if f.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newest(entries, f.Limit), nil
+}
+
+type MemorySink struct {
+	mu      sync.Mutex
+	size    int
+	entries []Entry
+}
+
+// NewMemorySink keeps the last size entries.
+func NewMemorySink(size int) *MemorySink {
+	return &MemorySink{size: size}
+}
+
+func (s *MemorySink) Write(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	if len(s.entries) > s.size {
+		s.entries = slices.Clone(s.entries[len(s.entries)-s.size:])
+	}
+	return nil
+}
+
+func (s *MemorySink) Query(f Filter) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := []Entry{}
+	for _, e := range s.entries {
+		if f.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return newest(entries, f.Limit), nil
+}
+
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	queue   chan Entry
+}
+
+// NewWebhookSink posts every entry as JSON to the url. The entries are queued
+// and posted in the background, a slow webhook must not hold the requests.
+func NewWebhookSink(url string, headers map[string]string) *WebhookSink {
+	s := &WebhookSink{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan Entry, webhookQueue),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues the entry, it's dropped when the queue is full.
+func (s *WebhookSink) Write(e Entry) error {
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		return errors.New("audit webhook queue is full, entry dropped")
+	}
+}
+
+func (s *WebhookSink) run() {
+	for e := range s.queue {
+		if err := s.post(e); err != nil {
+			slog.Error("audit webhook", "err", err.Error(), "user", e.User, "operation", e.Operation)
+		}
+	}
+}
+
+func (s *WebhookSink) post(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("audit webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"teleskopio/pkg/config"
+)
+
+func TestLoggerQuery(t *testing.T) {
+	l, err := New(config.Audit{Enabled: true, File: filepath.Join(t.TempDir(), "audit.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().UTC()
+	for i, e := range []Entry{
+		{User: "alice", Cluster: "https://staging", Kind: "Deployment", Name: "api", Operation: "scale", Outcome: Success},
+		{User: "bob", Cluster: "https://prod", Kind: "Pod", Name: "api-1", Operation: "delete", Outcome: Denied},
+		{User: "alice", Cluster: "https://prod", Kind: "Node", Name: "worker-1", Operation: "drain", Outcome: Failure},
+	} {
+		e.Time = start.Add(time.Duration(i) * time.Minute)
+		l.Record(e)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"newest first", Filter{}, []string{"worker-1", "api-1", "api"}},
+		{"by user", Filter{User: "alice"}, []string{"worker-1", "api"}},
+		{"by cluster and outcome", Filter{Cluster: "https://prod", Outcome: Denied}, []string{"api-1"}},
+		{"since", Filter{Since: start.Add(time.Minute)}, []string{"worker-1", "api-1"}},
+		{"limit", Filter{Limit: 1}, []string{"worker-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := l.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, e := range entries {
+				names = append(names, e.Name)
+			}
+			if len(names) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, names)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, names)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookSinkQueues(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan Entry, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var e Entry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	s := NewWebhookSink(srv.URL, nil)
+	done := make(chan struct{})
+	go func() {
+		// the webhook is stuck, the writes must not wait for it
+		for _, name := range []string{"api", "web"} {
+			if err := s.Write(Entry{Name: name}); err != nil {
+				t.Error(err)
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("write waits for the webhook")
+	}
+	close(release)
+	for _, want := range []string{"api", "web"} {
+		select {
+		case e := <-received:
+			if e.Name != want {
+				t.Fatalf("expected %s, got %s", want, e.Name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("entry %s not posted", want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InformerKey identifies a shared informer, an empty namespace means the
+// informer watches the resource across all namespaces. User is set when the
+// informer runs as an impersonated user, it's the user along with its groups
+// and scopes the topics of the informer too.
+type InformerKey struct {
+	Server        string
+	GVR           schema.GroupVersionResource
+	Namespace     string
+	FieldSelector string
+	User          string
+}
+
+func (k InformerKey) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", k.Server, k.GVR.String(), k.Namespace, k.FieldSelector, k.User)
+}
+
+type dynamicInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+	topics   []string
+	lastUsed time.Time
+}
+
+// DynamicInformers keeps one informer per cluster/GVR/namespace. Informers are
+// referenced by the websocket topics they publish to and stopped once nobody
+// is subscribed to those topics for idleTimeout. An informer the user is
+// forbidden to list or watch with is stopped at once, the error is kept
+// until it's started again.
+type DynamicInformers struct {
+	mu          sync.Mutex
+	informers   map[InformerKey]*dynamicInformer
+	failed      map[InformerKey]error
+	subscribers map[string]int
+	idleTimeout time.Duration
+}
+
+func NewDynamicInformers(idleTimeout time.Duration) *DynamicInformers {
+	return &DynamicInformers{
+		informers:   make(map[InformerKey]*dynamicInformer),
+		failed:      make(map[InformerKey]error),
+		subscribers: make(map[string]int),
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Start runs the informer for the key unless it's running already. The
+// informer relists and resumes the watch on its own when it expires. The
+// handlers publish to the topics, a running informer only gets the handler
+// when it brings topics the informer doesn't publish to yet, the others are
+// served by the handler of the first start.
+func (d *DynamicInformers) Start(key InformerKey, client dynamic.Interface, topics []string, handler cache.ResourceEventHandler) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if inf, ok := d.informers[key]; ok {
+		inf.lastUsed = time.Now()
+		if !slices.ContainsFunc(topics, func(t string) bool { return !slices.Contains(inf.topics, t) }) {
+			return nil
+		}
+		if _, err := inf.informer.AddEventHandler(handler); err != nil {
+			return err
+		}
+		for _, t := range topics {
+			if !slices.Contains(inf.topics, t) {
+				inf.topics = append(inf.topics, t)
+			}
+		}
+		return nil
+	}
+	informer := dynamicinformer.NewFilteredDynamicInformer(client, key.GVR, key.Namespace, 0, cache.Indexers{}, func(opts *metav1.ListOptions) {
+		opts.FieldSelector = key.FieldSelector
+	}).Informer()
+	if _, err := informer.AddEventHandler(handler); err != nil {
+		return err
+	}
+	inf := &dynamicInformer{
+		informer: informer,
+		stopCh:   make(chan struct{}),
+		topics:   slices.Clone(topics),
+		lastUsed: time.Now(),
+	}
+	if err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		if apierrors.IsForbidden(err) {
+			d.fail(key, inf, err)
+			return
+		}
+		slog.Debug("informer watch error, relisting", "key", key.String(), "err", err.Error())
+	}); err != nil {
+		return err
+	}
+	delete(d.failed, key)
+	d.informers[key] = inf
+	slog.Info("start informer", "key", key.String())
+	go informer.Run(inf.stopCh)
+	return nil
+}
+
+// SetSubscribers records how many websocket clients are subscribed to the
+// topic, it is meant to be used as the hub observer.
+func (d *DynamicInformers) SetSubscribers(topic string, subscribers int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if subscribers == 0 {
+		delete(d.subscribers, topic)
+		return
+	}
+	d.subscribers[topic] = subscribers
+}
+
+// List returns the objects from the informer store once it has synced along
+// with the resource version of the last sync.
+func (d *DynamicInformers) List(key InformerKey) ([]unstructured.Unstructured, string, bool) {
+	d.mu.Lock()
+	inf, ok := d.informers[key]
+	d.mu.Unlock()
+	if !ok || !inf.informer.HasSynced() {
+		return nil, "", false
+	}
+	objects := inf.informer.GetStore().List()
+	items := make([]unstructured.Unstructured, 0, len(objects))
+	for _, o := range objects {
+		if u, ok := o.(*unstructured.Unstructured); ok {
+			items = append(items, *u.DeepCopy())
+		}
+	}
+	return items, inf.informer.LastSyncResourceVersion(), true
+}
+
+// Err returns the error the informer of the key was stopped with, it's
+// forbidden to list or watch.
+func (d *DynamicInformers) Err(key InformerKey) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.failed[key]
+}
+
+// StopServer stops every informer of the cluster.
+func (d *DynamicInformers) StopServer(server string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, inf := range d.informers {
+		if key.Server == server {
+			d.stop(key, inf)
+		}
+	}
+	for key := range d.failed {
+		if key.Server == server {
+			delete(d.failed, key)
+		}
+	}
+}
+
+// Run stops idle informers, it blocks forever.
+func (d *DynamicInformers) Run() {
+	ticker := time.NewTicker(d.idleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.stopIdle(time.Now())
+	}
+}
+
+func (d *DynamicInformers) stopIdle(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, inf := range d.informers {
+		if d.refs(inf) > 0 {
+			inf.lastUsed = now
+			continue
+		}
+		if now.Sub(inf.lastUsed) >= d.idleTimeout {
+			d.stop(key, inf)
+		}
+	}
+}
+
+func (d *DynamicInformers) refs(inf *dynamicInformer) int {
+	refs := 0
+	for _, t := range inf.topics {
+		refs += d.subscribers[t]
+	}
+	return refs
+}
+
+func (d *DynamicInformers) fail(key InformerKey, inf *dynamicInformer, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.informers[key] != inf {
+		return
+	}
+	slog.Warn("informer is forbidden", "key", key.String(), "err", err.Error())
+	d.failed[key] = err
+	d.stop(key, inf)
+}
+
+func (d *DynamicInformers) stop(key InformerKey, inf *dynamicInformer) {
+	slog.Info("stop informer", "key", key.String())
+	close(inf.stopCh)
+	delete(d.informers, key)
+}
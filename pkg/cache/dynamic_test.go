@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestDynamicInformersStopIdle(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "PodList"})
+	informers := NewDynamicInformers(time.Minute)
+	key := InformerKey{Server: "srv", GVR: gvr}
+	topics := []string{"Pod-srv-updated", "Pod-srv-deleted"}
+
+	if err := informers.Start(key, client, topics, cache.ResourceEventHandlerFuncs{}); err != nil {
+		t.Fatalf("start informer: %v", err)
+	}
+	defer informers.StopServer("srv")
+	informers.SetSubscribers("Pod-srv-updated", 1)
+
+	now := time.Now()
+	informers.stopIdle(now.Add(2 * time.Minute))
+	if _, ok := informers.informers[key]; !ok {
+		t.Fatal("informer with subscribers was stopped")
+	}
+
+	informers.SetSubscribers("Pod-srv-updated", 0)
+	informers.stopIdle(now.Add(150 * time.Second))
+	if _, ok := informers.informers[key]; !ok {
+		t.Fatal("informer was stopped before idle timeout")
+	}
+	informers.stopIdle(now.Add(4 * time.Minute))
+	if _, ok := informers.informers[key]; ok {
+		t.Fatal("idle informer was not stopped")
+	}
+}
+
+func TestDynamicInformersForbidden(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "SecretList"})
+	client.PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(gvr.GroupResource(), "", errors.New("denied"))
+	})
+	informers := NewDynamicInformers(time.Minute)
+	key := InformerKey{Server: "srv", GVR: gvr, User: "alice"}
+	if err := informers.Start(key, client, []string{"secrets"}, cache.ResourceEventHandlerFuncs{}); err != nil {
+		t.Fatalf("start informer: %v", err)
+	}
+	defer informers.StopServer("srv")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for informers.Err(key) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the forbidden informer did not fail")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !apierrors.IsForbidden(informers.Err(key)) {
+		t.Fatalf("unexpected error %v", informers.Err(key))
+	}
+	if _, ok := informers.informers[key]; ok {
+		t.Fatal("the forbidden informer was not stopped")
+	}
+}
+
+func TestDynamicInformersStartAddsHandler(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("default")
+	pod.SetName("web")
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "PodList"}, pod)
+	informers := NewDynamicInformers(time.Minute)
+	key := InformerKey{Server: "srv", GVR: gvr}
+	defer informers.StopServer("srv")
+
+	added := make(chan string, 4)
+	handler := func(topic string) cache.ResourceEventHandler {
+		return cache.ResourceEventHandlerFuncs{AddFunc: func(any) { added <- topic }}
+	}
+	for _, topic := range []string{"first", "first", "second"} {
+		if err := informers.Start(key, client, []string{topic}, handler(topic)); err != nil {
+			t.Fatalf("start informer: %v", err)
+		}
+	}
+	got := map[string]int{}
+	for range 2 {
+		select {
+		case topic := <-added:
+			got[topic]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing events, got %v", got)
+		}
+	}
+	select {
+	case topic := <-added:
+		t.Fatalf("unexpected event of %s, the handler of a known topic was added", topic)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got["first"] != 1 || got["second"] != 1 {
+		t.Fatalf("unexpected events %v", got)
+	}
+}
@@ -2,12 +2,16 @@ package config
 
 import (
 	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,10 +20,12 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"gopkg.in/yaml.v3"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 var sapath = "/var/run/secrets/kubernetes.io/serviceaccount"
@@ -43,13 +49,50 @@ func GetConfigPath(configPathString string) string {
 }
 
 type User struct {
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Role     string `yaml:"role"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	Role     string   `yaml:"role"`
+	Groups   []string `yaml:"groups"`
+}
+
+// Verbs the role rules are able to grant
+var Verbs = []any{"get", "list", "watch", "create", "update", "delete", "scale", "drain", "trigger", "helm", "audit", "clusters", "exec", "portforward", "rollout", "*"}
+
+// Rule grants verbs on kinds in namespaces of clusters, an empty list or "*"
+// matches anything. Rules limited to namespaces never match cluster scoped
+// objects or requests across all namespaces.
+type Rule struct {
+	Clusters   []string `yaml:"clusters"`
+	Namespaces []string `yaml:"namespaces"`
+	Kinds      []string `yaml:"kinds"`
+	Verbs      []string `yaml:"verbs"`
+}
+
+func (r Rule) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Verbs, validation.Required, validation.Each(validation.In(Verbs...))),
+	)
+}
+
+// BuiltinRoles are available without being listed in roles, viewer is read
+// only and admin has full access.
+var BuiltinRoles = []string{"viewer", "admin"}
+
+type Role struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+func (r Role) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Name, validation.Required),
+		validation.Field(&r.Rules),
+	)
 }
 
 type MCP struct {
 	Enabled      bool   `yaml:"enabled"`
+	Role         string `yaml:"role"`
 	APIKey       string `yaml:"api_key"`
 	APIKeyHeader string `yaml:"api_key_header"`
 	Cors         struct {
@@ -58,6 +101,53 @@ type MCP struct {
 	} `yaml:"cors"`
 }
 
+type RoleMapping struct {
+	Group string `yaml:"group"`
+	Role  string `yaml:"role"`
+}
+
+type OIDC struct {
+	Enabled       bool          `yaml:"enabled"`
+	Issuer        string        `yaml:"issuer"`
+	ClientID      string        `yaml:"client_id"`
+	ClientSecret  string        `yaml:"client_secret"`
+	RedirectURL   string        `yaml:"redirect_url"`
+	Scopes        []string      `yaml:"scopes"`
+	UsernameClaim string        `yaml:"username_claim"`
+	GroupsClaim   string        `yaml:"groups_claim"`
+	RoleMappings  []RoleMapping `yaml:"role_mappings"`
+	DefaultRole   string        `yaml:"default_role"`
+	// UsernamePrefix and GroupsPrefix keep the provider users and groups
+	// apart from the local users and the kubernetes ones
+	UsernamePrefix string `yaml:"username_prefix"`
+	GroupsPrefix   string `yaml:"groups_prefix"`
+}
+
+func (o *OIDC) Validate() error {
+	return validation.ValidateStruct(o,
+		validation.Field(&o.Issuer, validation.When(o.Enabled, validation.Required)),
+		validation.Field(&o.ClientID, validation.When(o.Enabled, validation.Required)),
+		validation.Field(&o.RedirectURL, validation.When(o.Enabled, validation.Required)),
+	)
+}
+
+// Audit - entries go to every configured sink, the file is also used to
+// query them back.
+type Audit struct {
+	Enabled bool   `yaml:"enabled"`
+	File    string `yaml:"file"`
+	Stdout  bool   `yaml:"stdout"`
+	Webhook struct {
+		URL     string            `yaml:"url"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"webhook"`
+}
+
+type Cache struct {
+	List        bool           `yaml:"list"`
+	IdleTimeout *time.Duration `yaml:"idle_timeout"`
+}
+
 type Config struct {
 	LogColor       bool           `yaml:"log_color"`
 	LogJSON        bool           `yaml:"log_json"`
@@ -65,20 +155,171 @@ type Config struct {
 	ServerHTTP     string         `yaml:"server_http"`
 	Protocol       string         `yaml:"protocol"`
 	AuthDisabled   bool           `yaml:"auth_disabled"`
+	WatchConfig    bool           `yaml:"watch_config"`
 	JWTKey         string         `yaml:"jwt_key"`
 	JWTTokenExpire *time.Duration `yaml:"jwt_token_expire"`
 	Users          []User         `yaml:"users"`
+	Roles          []Role         `yaml:"roles"`
 	MCP            MCP            `yaml:"mcp"`
-	Kube           struct {
-		APIRequestTimeout string           `yaml:"api_request_timeout"`
-		Configs           []map[string]any `yaml:"configs"`
-	} `yaml:"kube"`
-	Version string
+	OIDC           OIDC           `yaml:"oidc"`
+	Audit          Audit          `yaml:"audit"`
+	Kube           Kube           `yaml:"kube"`
+	Helm           Helm           `yaml:"helm"`
+	Version        string
+}
+
+// Helm - ChartsDir holds the charts offered for install, chart directories
+// and archives, an index.yaml there adds the charts of a local repository.
+type Helm struct {
+	ChartsDir string `yaml:"charts_dir"`
+}
+
+// Kube - only the current context of every kubeconfig is imported unless
+// Contexts lists the context names to import, "*" imports all of them.
+// Store is the file the clusters added at runtime are kept in.
+type Kube struct {
+	APIRequestTimeout *time.Duration   `yaml:"api_request_timeout"`
+	Impersonate       bool             `yaml:"impersonate"`
+	FieldManager      string           `yaml:"field_manager"`
+	PortForward       string           `yaml:"port_forward_address"`
+	Cache             Cache            `yaml:"cache"`
+	Contexts          []string         `yaml:"contexts"`
+	Store             string           `yaml:"store"`
+	Clusters          []ClusterOptions `yaml:"clusters"`
+	Configs           []map[string]any `yaml:"configs"`
+}
+
+// ClusterOptions are matched by the context name or the server address.
+// Alias replaces the context name the cluster is known by, zero values keep
+// the kubeconfig settings.
+type ClusterOptions struct {
+	Context       string            `yaml:"context"`
+	Server        string            `yaml:"server"`
+	Alias         string            `yaml:"alias"`
+	Labels        map[string]string `yaml:"labels"`
+	QPS           float32           `yaml:"qps"`
+	Burst         int               `yaml:"burst"`
+	Timeout       *time.Duration    `yaml:"timeout"`
+	TLSServerName string            `yaml:"tls_server_name"`
+	ProxyURL      string            `yaml:"proxy_url"`
+}
+
+func (o ClusterOptions) Validate() error {
+	return validation.ValidateStruct(&o,
+		validation.Field(&o.Server, validation.When(o.Context == "", validation.Required.Error("server or context is required"))),
+		validation.Field(&o.QPS, validation.Min(float32(0))),
+		validation.Field(&o.Burst, validation.Min(0)),
+		validation.Field(&o.ProxyURL, validation.By(func(_ any) error {
+			if o.ProxyURL == "" {
+				return nil
+			}
+			_, err := url.Parse(o.ProxyURL)
+			return err
+		})),
+	)
+}
+
+func (k Kube) Validate() error {
+	return validation.ValidateStruct(&k,
+		validation.Field(&k.Clusters),
+	)
+}
+
+func (k *Kube) options(context, server string) ClusterOptions {
+	for _, o := range k.Clusters {
+		if (o.Context != "" && o.Context == context) || (o.Context == "" && o.Server == server) {
+			return o
+		}
+	}
+	return ClusterOptions{}
+}
+
+// tune applies the options to the rest config and returns the api request
+// timeout of the cluster.
+func (k *Kube) tune(o ClusterOptions, restCfg *rest.Config) (time.Duration, error) {
+	timeout := time.Duration(0)
+	if k.APIRequestTimeout != nil {
+		timeout = *k.APIRequestTimeout
+	}
+	if o.QPS > 0 {
+		restCfg.QPS = o.QPS
+	}
+	if o.Burst > 0 {
+		restCfg.Burst = o.Burst
+	}
+	if o.Timeout != nil {
+		timeout = *o.Timeout
+	}
+	if o.TLSServerName != "" {
+		restCfg.ServerName = o.TLSServerName
+	}
+	if o.ProxyURL != "" {
+		proxyURL, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return 0, fmt.Errorf("cluster %s proxy_url: %w", restCfg.Host, err)
+		}
+		restCfg.Proxy = http.ProxyURL(proxyURL)
+	}
+	return timeout, nil
+}
+
+// cluster creates the cluster of the context with its options applied.
+func (k *Kube) cluster(context string, restCfg *rest.Config) (*Cluster, error) {
+	o := k.options(context, restCfg.Host)
+	timeout, err := k.tune(o, restCfg)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewCluster(restCfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c.Name = cmp.Or(o.Alias, context, restCfg.Host)
+	c.Labels = o.Labels
+	c.options = o
+	return c, nil
+}
+
+// contexts creates the clusters of the selected contexts of the kubeconfig.
+func (k *Kube) contexts(kubeCfg *clientcmdapi.Config) ([]*Cluster, error) {
+	names := []string{kubeCfg.CurrentContext}
+	if len(k.Contexts) > 0 {
+		names = []string{}
+		for name := range kubeCfg.Contexts {
+			if slices.Contains(k.Contexts, "*") || slices.Contains(k.Contexts, name) {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+	}
+	clusters := []*Cluster{}
+	for _, name := range names {
+		restCfg, err := clientcmd.
+			NewNonInteractiveClientConfig(*kubeCfg, name, &clientcmd.ConfigOverrides{}, nil).
+			ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %w", name, err)
+		}
+		c, err := k.cluster(name, restCfg)
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %w", name, err)
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
 }
 
+// Cluster - Name is the context name or its alias, requests refer to the
+// cluster by it. Timeout bounds the api requests made by teleskopio,
+// Discovery gives up after it as well.
 type Cluster struct {
+	Name         string
 	Address      string
+	Labels       map[string]string
+	Timeout      time.Duration
 	Typed        *kubernetes.Clientset
+	Discovery    discovery.DiscoveryInterface
+	options      ClusterOptions
 	Dynamic      dynamic.Interface
 	RestConfig   *rest.Config
 	APIExtension *apiextensionsclientset.Clientset
@@ -88,6 +329,39 @@ type Users struct {
 	Users map[string]User
 }
 
+// NewCluster creates the clients of the cluster from the rest config.
+func NewCluster(restCfg *rest.Config, timeout time.Duration) (*Cluster, error) {
+	clientset, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	// the http client timeout would break watches and log streams, so it's
+	// only set for discovery
+	discoveryCfg := rest.CopyConfig(restCfg)
+	discoveryCfg.Timeout = timeout
+	disco, err := discovery.NewDiscoveryClientForConfig(discoveryCfg)
+	if err != nil {
+		return nil, err
+	}
+	dyn, err := dynamic.NewForConfig(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	apiExtension, err := apiextensionsclientset.NewForConfig(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Cluster{
+		RestConfig:   restCfg,
+		Address:      restCfg.Host,
+		Timeout:      timeout,
+		Typed:        clientset,
+		Discovery:    disco,
+		Dynamic:      dyn,
+		APIExtension: apiExtension,
+	}, nil
+}
+
 //nolint:gocognit,funlen
 func Parse(configPath string) (Config, []*Cluster, Users, error) {
 	var cfg Config
@@ -105,6 +379,22 @@ func Parse(configPath string) (Config, []*Cluster, Users, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return cfg, clusters, users, err
 	}
+	if cfg.Kube.APIRequestTimeout == nil {
+		defaultTimeout := 30 * time.Second
+		slog.Info("empty api request timeout set default", "value", defaultTimeout.String())
+		cfg.Kube.APIRequestTimeout = &defaultTimeout
+	}
+	names := map[string]bool{}
+	add := func(cs ...*Cluster) {
+		for _, c := range cs {
+			if names[c.Name] {
+				slog.Warn("duplicated cluster name, skip it, set an alias in kube.clusters", "name", c.Name, "server", c.Address)
+				continue
+			}
+			names[c.Name] = true
+			clusters = append(clusters, c)
+		}
+	}
 	for _, raw := range cfg.Kube.Configs {
 		b, err := yaml.Marshal(raw)
 		if err != nil {
@@ -116,33 +406,11 @@ func Parse(configPath string) (Config, []*Cluster, Users, error) {
 			return cfg, clusters, users, err
 		}
 
-		restCfg, err := clientcmd.
-			NewNonInteractiveClientConfig(*kubeCfg, kubeCfg.CurrentContext, &clientcmd.ConfigOverrides{}, nil).
-			ClientConfig()
-		if err != nil {
-			return cfg, clusters, users, err
-		}
-
-		clientset, err := kubernetes.NewForConfig(restCfg)
-		if err != nil {
-			return cfg, clusters, users, err
-		}
-		dyn, err := dynamic.NewForConfig(restCfg)
+		cs, err := cfg.Kube.contexts(kubeCfg)
 		if err != nil {
 			return cfg, clusters, users, err
 		}
-		apiExtension, err := apiextensionsclientset.NewForConfig(restCfg)
-		if err != nil {
-			return cfg, clusters, users, err
-		}
-
-		clusters = append(clusters, &Cluster{
-			RestConfig:   restCfg,
-			Address:      restCfg.Host,
-			Typed:        clientset,
-			Dynamic:      dyn,
-			APIExtension: apiExtension,
-		})
+		add(cs...)
 	}
 	kubeconfig := os.Getenv("KUBECONFIG")
 	if kubeconfig != "" {
@@ -150,33 +418,11 @@ func Parse(configPath string) (Config, []*Cluster, Users, error) {
 		if err != nil {
 			return cfg, clusters, users, fmt.Errorf("cant read KUBECONFIG %s", err)
 		}
-		restCfg, err := clientcmd.
-			NewNonInteractiveClientConfig(*kubeCfg, kubeCfg.CurrentContext, &clientcmd.ConfigOverrides{}, nil).
-			ClientConfig()
-		if err != nil {
-			return cfg, clusters, users, fmt.Errorf("cant read KUBECONFIG %s", err)
-		}
-
-		clientset, err := kubernetes.NewForConfig(restCfg)
-		if err != nil {
-			return cfg, clusters, users, fmt.Errorf("cant read KUBECONFIG %s", err)
-		}
-		dyn, err := dynamic.NewForConfig(restCfg)
+		cs, err := cfg.Kube.contexts(kubeCfg)
 		if err != nil {
 			return cfg, clusters, users, fmt.Errorf("cant read KUBECONFIG %s", err)
 		}
-		apiExtension, err := apiextensionsclientset.NewForConfig(restCfg)
-		if err != nil {
-			return cfg, clusters, users, err
-		}
-
-		clusters = append(clusters, &Cluster{
-			RestConfig:   restCfg,
-			Address:      restCfg.Host,
-			Typed:        clientset,
-			Dynamic:      dyn,
-			APIExtension: apiExtension,
-		})
+		add(cs...)
 	}
 
 	if _, err := os.Open(sapath); errors.Is(err, os.ErrNotExist) {
@@ -187,28 +433,15 @@ func Parse(configPath string) (Config, []*Cluster, Users, error) {
 		if err != nil {
 			slog.Error("cant auth with SA kubernetes cluster", "sa", sapath)
 		} else {
-			clientset, err := kubernetes.NewForConfig(inclusterconfig)
+			cluster, err := cfg.Kube.cluster("in-cluster", inclusterconfig)
 			if err != nil {
 				return cfg, clusters, users, err
 			}
-			dyn, err := dynamic.NewForConfig(inclusterconfig)
-			if err != nil {
-				return cfg, clusters, users, err
-			}
-			apiExtension, err := apiextensionsclientset.NewForConfig(inclusterconfig)
-			if err != nil {
-				return cfg, clusters, users, err
-			}
-			clusters = append(clusters, &Cluster{
-				RestConfig:   inclusterconfig,
-				Address:      inclusterconfig.Host,
-				Typed:        clientset,
-				Dynamic:      dyn,
-				APIExtension: apiExtension,
-			})
+			add(cluster)
 		}
 	}
 
+	cfg.mapUndeclaredRoles()
 	for _, u := range cfg.Users {
 		users.Users[u.Username] = u
 	}
@@ -217,18 +450,101 @@ func Parse(configPath string) (Config, []*Cluster, Users, error) {
 		slog.Info("empty jwt token expire duration set default", "value", defaultDuration.String())
 		cfg.JWTTokenExpire = &defaultDuration
 	}
+	if cfg.Kube.Cache.IdleTimeout == nil {
+		defaultIdleTimeout := 5 * time.Minute
+		slog.Info("empty informers idle timeout set default", "value", defaultIdleTimeout.String())
+		cfg.Kube.Cache.IdleTimeout = &defaultIdleTimeout
+	}
 	if cfg.Protocol == "" {
 		cfg.Protocol = "http"
 	}
+	if cfg.Kube.FieldManager == "" {
+		cfg.Kube.FieldManager = "teleskopio"
+	}
+	if cfg.Kube.PortForward == "" {
+		cfg.Kube.PortForward = "127.0.0.1"
+	}
+	if cfg.MCP.APIKeyHeader == "" {
+		cfg.MCP.APIKeyHeader = "X-MCP"
+	}
+	if cfg.MCP.Role == "" {
+		cfg.MCP.Role = "viewer"
+	}
+	if len(cfg.OIDC.Scopes) == 0 {
+		cfg.OIDC.Scopes = []string{"openid", "profile", "email", "groups"}
+	}
+	if cfg.OIDC.UsernameClaim == "" {
+		cfg.OIDC.UsernameClaim = "preferred_username"
+	}
+	if cfg.OIDC.GroupsClaim == "" {
+		cfg.OIDC.GroupsClaim = "groups"
+	}
 	return cfg, clusters, users, nil
 }
 
 func (c *Config) Validate() error {
+	declared := c.declaredRole()
 	return validation.ValidateStruct(c,
 		validation.Field(&c.LogLevel, validation.Required, validation.In("INFO", "DEBUG", "WARN").Error("must be one of 'INFO', 'DEBUG', 'WARN'")),
+		validation.Field(&c.OIDC, validation.By(func(_ any) error {
+			return validation.ValidateStruct(&c.OIDC,
+				validation.Field(&c.OIDC.DefaultRole, declared),
+				validation.Field(&c.OIDC.RoleMappings, validation.Each(validation.By(func(v any) error {
+					return validation.Validate(v.(RoleMapping).Role, declared)
+				}))),
+			)
+		})),
+		validation.Field(&c.Users, validation.Each(validation.By(func(v any) error {
+			u := v.(User)
+			if slices.ContainsFunc(u.Groups, func(g string) bool { return strings.HasPrefix(g, "system:") }) {
+				return errors.New("the system: groups are not impersonated")
+			}
+			return validation.Validate(u.Role, declared)
+		}))),
+		validation.Field(&c.MCP, validation.By(func(_ any) error {
+			return validation.ValidateStruct(&c.MCP, validation.Field(&c.MCP.Role, declared))
+		})),
+		validation.Field(&c.Roles),
+		validation.Field(&c.Kube),
 	)
 }
 
+// mapUndeclaredRoles maps the roles missing from the builtin ones and from
+// roles to viewer, they were accepted before the roles were checked. An empty
+// role is kept, it denies the login.
+func (c *Config) mapUndeclaredRoles() {
+	declared := func(role string) bool {
+		return role == "" || slices.Contains(BuiltinRoles, role) || slices.ContainsFunc(c.Roles, func(r Role) bool { return r.Name == role })
+	}
+	mapRole := func(role *string, owner string) {
+		if !declared(*role) {
+			slog.Warn("undeclared role, map it to viewer", "role", *role, "of", owner)
+			*role = "viewer"
+		}
+	}
+	for i := range c.Users {
+		mapRole(&c.Users[i].Role, "user "+c.Users[i].Username)
+	}
+	for i := range c.OIDC.RoleMappings {
+		mapRole(&c.OIDC.RoleMappings[i].Role, "oidc group "+c.OIDC.RoleMappings[i].Group)
+	}
+	mapRole(&c.OIDC.DefaultRole, "oidc default_role")
+	mapRole(&c.MCP.Role, "mcp")
+}
+
+// declaredRole accepts the builtin roles and the ones listed in roles, the
+// roles missing from both have no access.
+func (c *Config) declaredRole() validation.Rule {
+	names := make([]any, 0, len(BuiltinRoles)+len(c.Roles))
+	for _, name := range BuiltinRoles {
+		names = append(names, name)
+	}
+	for _, r := range c.Roles {
+		names = append(names, r.Name)
+	}
+	return validation.In(names...).Error("must be a builtin role or one of the roles")
+}
+
 //go:embed config.TEMPLATE.yaml
 var configTemplate string
 
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
 )
 
 func TestGetConfigPath(t *testing.T) {
@@ -104,3 +109,100 @@ func TestGetConfigPath(t *testing.T) {
 		})
 	}
 }
+
+func TestKubeCluster(t *testing.T) {
+	global, slow := 30*time.Second, 2*time.Minute
+	kube := Kube{
+		APIRequestTimeout: &global,
+		Clusters: []ClusterOptions{{
+			Context:       "kind-slow",
+			Alias:         "slow",
+			Labels:        map[string]string{"env": "dev"},
+			QPS:           50,
+			Burst:         100,
+			Timeout:       &slow,
+			TLSServerName: "kubernetes.default",
+			ProxyURL:      "http://proxy:3128",
+		}},
+	}
+
+	restCfg := &rest.Config{Host: "https://slow:6443"}
+	c, err := kube.cluster("kind-slow", restCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "slow" || c.Labels["env"] != "dev" || c.Timeout != slow {
+		t.Fatalf("cluster options not applied, name %s, labels %v, timeout %s", c.Name, c.Labels, c.Timeout)
+	}
+	if restCfg.QPS != 50 || restCfg.Burst != 100 || restCfg.ServerName != "kubernetes.default" {
+		t.Fatalf("cluster options not applied, config %+v", restCfg)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://slow:6443/api", nil)
+	if proxy, err := restCfg.Proxy(req); err != nil || proxy.Host != "proxy:3128" {
+		t.Fatalf("expected proxy:3128, got %v %v", proxy, err)
+	}
+
+	other := &rest.Config{Host: "https://slow:6443"}
+	c, err = kube.cluster("kind-other", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "kind-other" || c.Timeout != global || other.QPS != 0 || other.Proxy != nil {
+		t.Fatalf("other context must keep the defaults, name %s, timeout %s, config %+v", c.Name, c.Timeout, other)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Config{LogLevel: "INFO", Kube: Kube{Clusters: []ClusterOptions{{Context: "kind"}}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("valid config refused: %v", err)
+	}
+	cfg.Kube.Clusters = append(cfg.Kube.Clusters, ClusterOptions{QPS: -1})
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("invalid cluster options must be refused")
+	}
+}
+
+func TestValidateRoles(t *testing.T) {
+	cfg := Config{
+		LogLevel: "INFO",
+		MCP:      MCP{Role: "viewer"},
+		Roles:    []Role{{Name: "oncall", Rules: []Rule{{Verbs: []string{"get"}}}}},
+		Users:    []User{{Username: "admin", Role: "admin"}, {Username: "bob", Role: "oncall"}},
+		OIDC:     OIDC{RoleMappings: []RoleMapping{{Group: "sre", Role: "oncall"}}, DefaultRole: "viewer"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("declared roles must be valid: %v", err)
+	}
+	for name, invalid := range map[string]func(c *Config){
+		"user":         func(c *Config) { c.Users[1].Role = "ops" },
+		"role mapping": func(c *Config) { c.OIDC.RoleMappings[0].Role = "ops" },
+		"default role": func(c *Config) { c.OIDC.DefaultRole = "ops" },
+		"mcp role":     func(c *Config) { c.MCP.Role = "ops" },
+		"system group": func(c *Config) { c.Users[1].Groups = []string{"system:masters"} },
+	} {
+		c := cfg
+		c.Users = slices.Clone(cfg.Users)
+		c.OIDC.RoleMappings = slices.Clone(cfg.OIDC.RoleMappings)
+		invalid(&c)
+		if err := c.Validate(); err == nil {
+			t.Fatalf("%s must be refused", name)
+		}
+	}
+}
+
+func TestMapUndeclaredRoles(t *testing.T) {
+	cfg := Config{
+		MCP:   MCP{Role: "ops"},
+		Roles: []Role{{Name: "oncall"}},
+		Users: []User{{Username: "bob", Role: "oncall"}, {Username: "eve", Role: "ops"}},
+		OIDC:  OIDC{RoleMappings: []RoleMapping{{Group: "sre", Role: "ops"}}},
+	}
+	cfg.mapUndeclaredRoles()
+	if cfg.Users[0].Role != "oncall" || cfg.Users[1].Role != "viewer" || cfg.OIDC.RoleMappings[0].Role != "viewer" || cfg.MCP.Role != "viewer" {
+		t.Fatalf("unexpected roles %+v %+v %s", cfg.Users, cfg.OIDC.RoleMappings, cfg.MCP.Role)
+	}
+	if cfg.OIDC.DefaultRole != "" {
+		t.Fatal("the empty default role denies the login, it must be kept")
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"sync/atomic"
+)
+
+// Current holds the config in use, a reload replaces it as a whole so the
+// readers always see a consistent config.
+type Current struct {
+	v atomic.Pointer[current]
+}
+
+// current - the config and the users are swapped together.
+type current struct {
+	cfg   *Config
+	users *Users
+}
+
+func NewCurrent(cfg *Config, users *Users) *Current {
+	c := &Current{}
+	c.Set(cfg, users)
+	return c
+}
+
+func (c *Current) Get() *Config {
+	return c.v.Load().cfg
+}
+
+func (c *Current) Users() *Users {
+	return c.v.Load().users
+}
+
+func (c *Current) Set(cfg *Config, users *Users) {
+	c.v.Store(&current{cfg: cfg, users: users})
+}
+
+// Equal reports whether both clusters connect the same way, it's used to keep
+// the unchanged clusters on reload.
+func (c *Cluster) Equal(o *Cluster) bool {
+	a, b := c.RestConfig, o.RestConfig
+	return c.Name == o.Name &&
+		c.Address == o.Address &&
+		c.Timeout == o.Timeout &&
+		maps.Equal(c.Labels, o.Labels) &&
+		reflect.DeepEqual(c.options, o.options) &&
+		a.Host == b.Host &&
+		a.APIPath == b.APIPath &&
+		a.BearerToken == b.BearerToken &&
+		a.BearerTokenFile == b.BearerTokenFile &&
+		a.Username == b.Username &&
+		a.Password == b.Password &&
+		reflect.DeepEqual(a.TLSClientConfig, b.TLSClientConfig) &&
+		reflect.DeepEqual(a.ExecProvider, b.ExecProvider) &&
+		reflect.DeepEqual(a.AuthProvider, b.AuthProvider) &&
+		reflect.DeepEqual(a.Impersonate, b.Impersonate)
+}
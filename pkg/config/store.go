@@ -0,0 +1,163 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// StoredCluster is a cluster added at runtime along with its kubeconfig.
+type StoredCluster struct {
+	Name       string            `yaml:"name"`
+	Context    string            `yaml:"context"`
+	Labels     map[string]string `yaml:"labels"`
+	Kubeconfig string            `yaml:"kubeconfig"`
+}
+
+// ClusterStore persists the clusters added at runtime to a file, nothing is
+// persisted when the path is empty.
+type ClusterStore struct {
+	mu       sync.Mutex
+	path     string
+	clusters []StoredCluster
+}
+
+func NewClusterStore(path string) (*ClusterStore, error) {
+	s := &ClusterStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &s.clusters); err != nil {
+		return nil, fmt.Errorf("cant read cluster store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *ClusterStore) Enabled() bool {
+	return s.path != ""
+}
+
+func (s *ClusterStore) Clusters() []StoredCluster {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.clusters)
+}
+
+// Has reports whether the cluster is persisted in the store.
+func (s *ClusterStore) Has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.ContainsFunc(s.clusters, func(sc StoredCluster) bool { return sc.Name == name })
+}
+
+func (s *ClusterStore) Add(c StoredCluster) error {
+	if !s.Enabled() {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters = append(slices.DeleteFunc(s.clusters, func(sc StoredCluster) bool {
+		return sc.Name == c.Name
+	}), c)
+	return s.save()
+}
+
+func (s *ClusterStore) Remove(name string) error {
+	if !s.Enabled() {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters = slices.DeleteFunc(s.clusters, func(sc StoredCluster) bool {
+		return sc.Name == name
+	})
+	return s.save()
+}
+
+// save replaces the file at once, the kubeconfigs hold credentials so it's
+// readable by the owner only.
+func (s *ClusterStore) save() error {
+	data, err := yaml.Marshal(s.clusters)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".clusters-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// FromKubeconfig creates the cluster of the context, the current one when
+// it's empty. Kubeconfigs referring to local files or exec plugins are
+// rejected as they'd run with the teleskopio permissions on the host.
+func (k *Kube) FromKubeconfig(data []byte, context, alias string, labels map[string]string) (*Cluster, error) {
+	kubeCfg, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	context = cmp.Or(context, kubeCfg.CurrentContext)
+	if _, ok := kubeCfg.Contexts[context]; !ok {
+		return nil, fmt.Errorf("context %q not found", context)
+	}
+	if err := selfContained(kubeCfg); err != nil {
+		return nil, err
+	}
+	restCfg, err := clientcmd.
+		NewNonInteractiveClientConfig(*kubeCfg, context, &clientcmd.ConfigOverrides{}, nil).
+		ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	c, err := k.cluster(context, restCfg)
+	if err != nil {
+		return nil, err
+	}
+	if alias != "" {
+		c.Name = alias
+	}
+	if labels != nil {
+		c.Labels = labels
+	}
+	return c, nil
+}
+
+func selfContained(kubeCfg *clientcmdapi.Config) error {
+	for name, a := range kubeCfg.AuthInfos {
+		if a.Exec != nil || a.AuthProvider != nil {
+			return fmt.Errorf("user %s: exec and auth provider plugins are not allowed", name)
+		}
+		if a.ClientCertificate != "" || a.ClientKey != "" || a.TokenFile != "" {
+			return fmt.Errorf("user %s: credentials must be embedded", name)
+		}
+	}
+	for name, c := range kubeCfg.Clusters {
+		if c.CertificateAuthority != "" {
+			return fmt.Errorf("cluster %s: certificate authority must be embedded", name)
+		}
+	}
+	return nil
+}
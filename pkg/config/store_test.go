@@ -0,0 +1,72 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+  - name: dev
+    cluster:
+      server: https://dev:6443
+contexts:
+  - name: dev
+    context:
+      cluster: dev
+      user: dev
+users:
+  - name: dev
+    user:
+      token: secret
+`
+
+func TestFromKubeconfig(t *testing.T) {
+	kube := Kube{}
+	c, err := kube.FromKubeconfig([]byte(testKubeconfig), "", "dev-eu", map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "dev-eu" || c.Address != "https://dev:6443" || c.Labels["region"] != "eu" {
+		t.Fatalf("unexpected cluster %s %s %v", c.Name, c.Address, c.Labels)
+	}
+
+	execConfig := strings.Replace(testKubeconfig, "      token: secret", "      exec:\n        apiVersion: client.authentication.k8s.io/v1\n        command: sh", 1)
+	if _, err := kube.FromKubeconfig([]byte(execConfig), "", "", nil); err == nil {
+		t.Fatal("exec plugins must be rejected")
+	}
+	if _, err := kube.FromKubeconfig([]byte(testKubeconfig), "prod", "", nil); err == nil {
+		t.Fatal("missing context must be rejected")
+	}
+}
+
+func TestClusterStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	s, err := NewClusterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dev", "staging"} {
+		if err := s.Add(StoredCluster{Name: name, Kubeconfig: testKubeconfig}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Remove("dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewClusterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters := reloaded.Clusters()
+	if len(clusters) != 1 || clusters[0].Name != "staging" || clusters[0].Kubeconfig != testKubeconfig {
+		t.Fatalf("unexpected stored clusters %+v", clusters)
+	}
+	if reloaded.Has("dev") || !reloaded.Has("staging") {
+		t.Fatal("Has must match the stored clusters")
+	}
+}
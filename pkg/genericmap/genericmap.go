@@ -28,3 +28,8 @@ func (m *Map[K, V]) Load(key K) (V, bool) {
 func (m *Map[K, V]) Store(key K, val V) {
 	m.inner.Store(key, val)
 }
+
+func (m *Map[K, V]) LoadOrStore(key K, val V) (V, bool) {
+	actual, loaded := m.inner.LoadOrStore(key, val)
+	return actual.(V), loaded
+}
@@ -0,0 +1,332 @@
+package kubeapi
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/model"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sYAML "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// Operations of CreateOrUpdateKubeResource, apply is a server-side apply.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpApply  = "apply"
+)
+
+// CreateOrUpdateKubeResource writes every object of the manifest, documents
+// and List items are written in order with the namespaces and CRDs first.
+// A failed object doesn't stop the others, it's reported in its result.
+// Atomic requests dry-run the whole manifest first and write nothing unless
+// all the objects pass. authorize is called with each decoded object before
+// it's sent to the api server.
+func (k *KubeAPI) CreateOrUpdateKubeResource(
+	ctx context.Context,
+	req model.ObjectRequest,
+	op string,
+	authorize func(obj *unstructured.Unstructured) error,
+) ([]model.ObjectResult, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := decodeObjects(req.Yaml)
+	if err != nil {
+		return nil, err
+	}
+	if req.Atomic && !req.DryRun {
+		check := req
+		check.DryRun = true
+		results := k.writeAll(ctx, server, objs, op, check, authorize, bundled(objs, req.Namespace))
+		if slices.ContainsFunc(results, func(r model.ObjectResult) bool { return r.Err != nil }) {
+			for i := range results {
+				if results[i].Err == nil {
+					results[i].Status, results[i].Object = model.ObjectSkipped, nil
+				}
+			}
+			return results, nil
+		}
+	}
+	return k.writeAll(ctx, server, objs, op, req, authorize, nil), nil
+}
+
+func (k *KubeAPI) writeAll(
+	ctx context.Context,
+	server *config.Cluster,
+	objs []*unstructured.Unstructured,
+	op string,
+	req model.ObjectRequest,
+	authorize func(obj *unstructured.Unstructured) error,
+	skip func(obj *unstructured.Unstructured) bool,
+) []model.ObjectResult {
+	results := make([]model.ObjectResult, 0, len(objs))
+	for _, obj := range objs {
+		// the dry-run pass must not change the objects of the real one
+		obj = obj.DeepCopy()
+		if skip != nil && skip(obj) {
+			// it's checked by the real pass, once its dependencies exist
+			results = append(results, objectResult(obj, nil, authorize(obj)))
+			continue
+		}
+		ri, err := k.objectInterface(server, obj, req.Namespace)
+		if err == nil {
+			err = authorize(obj)
+		}
+		var written *unstructured.Unstructured
+		if err == nil {
+			written, err = k.write(ctx, ri, obj, op, req)
+		}
+		if err == nil && !req.DryRun && obj.GroupVersionKind().GroupKind() == crdKind {
+			// the objects of the new kind may follow in the manifest
+			k.InvalidateDiscovery(req.Server)
+		}
+		results = append(results, objectResult(obj, written, err))
+	}
+	return results
+}
+
+func objectResult(obj, written *unstructured.Unstructured, err error) model.ObjectResult {
+	r := model.ObjectResult{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Status:     model.ObjectApplied,
+		Err:        err,
+	}
+	if err != nil {
+		r.Status, r.Error = model.ObjectFailed, err.Error()
+		return r
+	}
+	if written != nil {
+		r.Object = written.Object
+	}
+	return r
+}
+
+// bundled reports the objects that can't be dry-run before the manifest is
+// written, they're in a namespace or of a kind created by the manifest.
+func bundled(objs []*unstructured.Unstructured, namespace string) func(obj *unstructured.Unstructured) bool {
+	namespaces := map[string]bool{}
+	kinds := map[schema.GroupKind]bool{}
+	for _, obj := range objs {
+		switch obj.GroupVersionKind().GroupKind() {
+		case schema.GroupKind{Kind: "Namespace"}:
+			namespaces[obj.GetName()] = true
+		case crdKind:
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			kinds[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+	return func(obj *unstructured.Unstructured) bool {
+		return namespaces[cmp.Or(obj.GetNamespace(), namespace)] || kinds[obj.GroupVersionKind().GroupKind()]
+	}
+}
+
+// DiffKubeResource dry-runs the operation and compares the live object with
+// the one the api server would persist, the live object is empty when it
+// doesn't exist yet.
+func (k *KubeAPI) DiffKubeResource(
+	ctx context.Context,
+	req model.ObjectRequest,
+	op string,
+	authorize func(obj *unstructured.Unstructured) error,
+) (model.ObjectDiff, error) {
+	var diff model.ObjectDiff
+	if err := req.Validate(); err != nil {
+		return diff, err
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return diff, err
+	}
+	objs, err := decodeObjects(req.Yaml)
+	if err != nil {
+		return diff, err
+	}
+	if len(objs) != 1 {
+		return diff, fmt.Errorf("diff needs a single object, the manifest has %d", len(objs))
+	}
+	obj := objs[0]
+	ri, err := k.objectInterface(server, obj, req.Namespace)
+	if err != nil {
+		return diff, err
+	}
+	if err := authorize(obj); err != nil {
+		return diff, err
+	}
+	live, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return diff, err
+	}
+	if apierrors.IsNotFound(err) {
+		live = nil
+	}
+	req.DryRun = true
+	merged, err := k.write(ctx, ri, obj, op, req)
+	if err != nil {
+		return diff, err
+	}
+	liveYAML, err := diffYAML(live)
+	if err != nil {
+		return diff, err
+	}
+	mergedYAML, err := diffYAML(merged)
+	if err != nil {
+		return diff, err
+	}
+	diff.Diff, err = UnifiedDiff(liveYAML, mergedYAML, "live", "merged")
+	if err != nil {
+		return diff, err
+	}
+	if live != nil {
+		diff.Live = live.Object
+	}
+	diff.Merged = merged.Object
+	return diff, nil
+}
+
+func (k *KubeAPI) write(
+	ctx context.Context,
+	ri dynamic.ResourceInterface,
+	obj *unstructured.Unstructured,
+	op string,
+	req model.ObjectRequest,
+) (*unstructured.Unstructured, error) {
+	var dryRun []string
+	if req.DryRun {
+		dryRun = []string{metav1.DryRunAll}
+	}
+	fieldManager := cmp.Or(req.FieldManager, k.fieldManager)
+	switch op {
+	case OpCreate:
+		return ri.Create(ctx, obj, metav1.CreateOptions{DryRun: dryRun, FieldManager: fieldManager})
+	case OpUpdate:
+		return ri.Update(ctx, obj, metav1.UpdateOptions{DryRun: dryRun, FieldManager: fieldManager})
+	case OpApply:
+		// the objects opened in the editor carry them, apply refuses them
+		obj.SetManagedFields(nil)
+		return ri.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{DryRun: dryRun, FieldManager: fieldManager, Force: req.Force})
+	}
+	return nil, fmt.Errorf("unknown operation %s", op)
+}
+
+// decodeObjects reads every document of the manifest, YAML or JSON, List
+// kinds are expanded to their items. The namespaces go first and then the
+// CRDs, so the objects of the manifest can rely on them.
+func decodeObjects(manifest string) ([]*unstructured.Unstructured, error) {
+	decoder := k8sYAML.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 1024)
+	objs := []*unstructured.Unstructured{}
+	for doc := 1; ; doc++ {
+		var m map[string]any
+		if err := decoder.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if len(m) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: m}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("document %d: apiVersion and kind are required", doc)
+		}
+		if !obj.IsList() {
+			objs = append(objs, obj)
+			continue
+		}
+		if err := obj.EachListItem(func(item runtime.Object) error {
+			objs = append(objs, item.(*unstructured.Unstructured))
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+	}
+	if len(objs) == 0 {
+		return nil, errors.New("the manifest has no objects")
+	}
+	slices.SortStableFunc(objs, func(a, b *unstructured.Unstructured) int {
+		return cmp.Compare(applyOrder(a), applyOrder(b))
+	})
+	return objs, nil
+}
+
+var (
+	crdKind     = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+	crdResource = schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+)
+
+func applyOrder(obj *unstructured.Unstructured) int {
+	switch obj.GroupVersionKind().GroupKind() {
+	case schema.GroupKind{Kind: "Namespace"}:
+		return 0
+	case crdKind:
+		return 1
+	}
+	return 2
+}
+
+// objectInterface resolves the resource of the object kind with the
+// RESTMapper, namespaced objects without a namespace get the default one.
+func (k *KubeAPI) objectInterface(server *config.Cluster, obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	res := model.APIResource{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}
+	if err := k.ResolveResource(server.Name, &res); err != nil {
+		return nil, err
+	}
+	if !res.Namespaced {
+		return server.Dynamic.Resource(res.GetGVR()), nil
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(cmp.Or(namespace, metav1.NamespaceDefault))
+	}
+	return server.Dynamic.Resource(res.GetGVR()).Namespace(obj.GetNamespace()), nil
+}
+
+// diffYAML renders the object without the managed fields, they're noise in
+// a diff.
+func diffYAML(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	b, err := yaml.Marshal(obj.Object)
+	return string(b), err
+}
+
+// UnifiedDiff returns the diff of the texts, empty when they are equal.
+func UnifiedDiff(a, b, from, to string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: from,
+		ToFile:   to,
+		Context:  3,
+	})
+}
@@ -0,0 +1,85 @@
+package kubeapi
+
+import (
+	"testing"
+)
+
+const bundle = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: shop
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: api
+    namespace: shop
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: api
+---
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: carts.shop.io
+spec:
+  group: shop.io
+  names:
+    kind: Cart
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: shop
+---
+apiVersion: shop.io/v1
+kind: Cart
+metadata:
+  name: default
+  namespace: default
+`
+
+func TestDecodeObjects(t *testing.T) {
+	objs, err := decodeObjects(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Namespace", "CustomResourceDefinition", "Deployment", "Service", "ConfigMap", "Cart"}
+	if len(objs) != len(want) {
+		t.Fatalf("expected %d objects, got %d", len(want), len(objs))
+	}
+	for i, obj := range objs {
+		if obj.GetKind() != want[i] {
+			t.Fatalf("expected %s at %d, got %s", want[i], i, obj.GetKind())
+		}
+	}
+
+	skip := bundled(objs, "")
+	for _, tt := range []struct {
+		kind string
+		want bool
+	}{
+		{"Deployment", true},
+		{"ConfigMap", false},
+		{"Cart", true},
+	} {
+		for _, obj := range objs {
+			if obj.GetKind() == tt.kind && skip(obj) != tt.want {
+				t.Fatalf("expected bundled %s to be %v", tt.kind, tt.want)
+			}
+		}
+	}
+
+	for _, manifest := range []string{"", "---\n", "metadata:\n  name: api\n"} {
+		if _, err := decodeObjects(manifest); err == nil {
+			t.Fatalf("expected an error for %q", manifest)
+		}
+	}
+}
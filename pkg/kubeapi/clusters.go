@@ -0,0 +1,118 @@
+package kubeapi
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/model"
+)
+
+// SyncClusters replaces the configured clusters, the unchanged ones keep
+// their informers and clients. Clusters added at runtime are left alone.
+func (k *KubeAPI) SyncClusters(clusters []*config.Cluster) {
+	next := map[string]*config.Cluster{}
+	for _, c := range clusters {
+		next[c.Name] = c
+	}
+	k.mu.Lock()
+	stale := []string{}
+	for name, c := range k.clusters {
+		if k.runtime[name] {
+			continue
+		}
+		if n, ok := next[name]; !ok || !c.Equal(n) {
+			stale = append(stale, name)
+			delete(k.clusters, name)
+		}
+	}
+	for name, c := range next {
+		if k.runtime[name] {
+			slog.Warn("cluster added at runtime has the same name, keep it", "name", name)
+			continue
+		}
+		if _, ok := k.clusters[name]; !ok {
+			k.clusters[name] = c
+			slog.Info("cluster loaded", "name", name, "server", c.Address)
+		}
+	}
+	k.mu.Unlock()
+	for _, name := range stale {
+		slog.Info("cluster changed or removed", "name", name)
+		k.release(name)
+	}
+}
+
+// AddCluster makes the cluster available to the requests, the name must be unique.
+func (k *KubeAPI) AddCluster(c *config.Cluster) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, found := k.clusters[c.Name]; found {
+		return fmt.Errorf("cluster %s already exists", c.Name)
+	}
+	k.clusters[c.Name] = c
+	k.runtime[c.Name] = true
+	slog.Info("cluster added", "name", c.Name, "server", c.Address)
+	return nil
+}
+
+// ConfiguredCluster reports whether the cluster is known and wasn't added at
+// runtime, it comes from the config or from the store.
+func (k *KubeAPI) ConfiguredCluster(name string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, found := k.clusters[name]
+	return found && !k.runtime[name]
+}
+
+// RemoveCluster forgets the cluster along with its informers and clients.
+func (k *KubeAPI) RemoveCluster(name string) error {
+	k.mu.Lock()
+	c, found := k.clusters[name]
+	delete(k.clusters, name)
+	delete(k.runtime, name)
+	k.mu.Unlock()
+	if !found {
+		return fmt.Errorf("server %s not found", name)
+	}
+	k.release(name)
+	slog.Info("cluster removed", "name", name, "server", c.Address)
+	return nil
+}
+
+// release stops the informers and the port forwards of the cluster and
+// drops its clients and discovery cache.
+func (k *KubeAPI) release(name string) {
+	k.mu.Lock()
+	delete(k.discovery, name)
+	k.mu.Unlock()
+	k.informers.StopServer(name)
+	k.stopForwards(func(f *portForward) bool { return f.Server == name })
+	for key := range k.userClients.Items() {
+		if strings.HasPrefix(key, name+"|") {
+			k.userClients.Delete(key)
+		}
+	}
+}
+
+// TestCluster checks the cluster is reachable with the discovery and the
+// version requests.
+func (k *KubeAPI) TestCluster(name string) (model.ClusterStatus, error) {
+	status := model.ClusterStatus{Server: name}
+	s, err := k.getClient(name)
+	if err != nil {
+		return status, err
+	}
+	ver, err := s.Discovery.ServerVersion()
+	if err != nil {
+		return status, fmt.Errorf("version: %w", err)
+	}
+	groups, err := s.Discovery.ServerGroups()
+	if err != nil {
+		return status, fmt.Errorf("discovery: %w", err)
+	}
+	status.Version = ver.GitVersion
+	status.Groups = len(groups.Groups)
+	return status, nil
+}
@@ -0,0 +1,160 @@
+package kubeapi
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/model"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// discoveryRefresh limits how often a lookup missing from the cache refreshes
+// it, a misspelled kind must not refetch the discovery on every request.
+const discoveryRefresh = 10 * time.Second
+
+// clusterDiscovery caches the discovery of a cluster, the RESTMapper is built
+// from the cache on first use and reset along with it.
+type clusterDiscovery struct {
+	// cluster the cache was made for, a changed cluster gets a new one
+	cluster    *config.Cluster
+	client     discovery.CachedDiscoveryInterface
+	mapper     *restmapper.DeferredDiscoveryRESTMapper
+	shortcuts  meta.RESTMapper
+	categories restmapper.CategoryExpander
+
+	mu        sync.Mutex
+	refreshed time.Time
+}
+
+func newClusterDiscovery(cluster *config.Cluster) *clusterDiscovery {
+	client := memory.NewMemCacheClient(cluster.Discovery)
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(client)
+	return &clusterDiscovery{
+		cluster: cluster,
+		client:  client,
+		mapper:  mapper,
+		shortcuts: restmapper.NewShortcutExpander(mapper, client, func(warning string) {
+			slog.Debug("resource shortcut", "cluster", cluster.Name, "warning", warning)
+		}),
+		categories: restmapper.NewDiscoveryCategoryExpander(client),
+	}
+}
+
+// refreshAfterMiss invalidates the cache unless it was refreshed lately, it
+// reports whether a retry may find what was missing.
+func (d *clusterDiscovery) refreshAfterMiss(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.refreshed) < discoveryRefresh {
+		return false
+	}
+	d.refreshed = now
+	d.mapper.Reset()
+	return true
+}
+
+// mapping resolves the kind of the resource, the resource name when the kind
+// is empty. The name may be plural, singular or a short name.
+func (d *clusterDiscovery) mapping(res model.APIResource) (*meta.RESTMapping, error) {
+	if res.Kind == "" {
+		gvk, err := d.shortcuts.KindFor(schema.GroupVersionResource{Group: res.Group, Version: res.Version, Resource: res.Resource})
+		if err != nil {
+			return nil, err
+		}
+		return d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	var versions []string
+	if res.Version != "" {
+		versions = append(versions, res.Version)
+	}
+	return d.mapper.RESTMapping(schema.GroupKind{Group: res.Group, Kind: res.Kind}, versions...)
+}
+
+// discoveryFor returns the discovery cache of the cluster, it's made on first
+// use and dropped when the cluster changes or goes away.
+func (k *KubeAPI) discoveryFor(server string) (*clusterDiscovery, error) {
+	s, err := k.getClient(server)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	d, ok := k.discovery[server]
+	if !ok || d.cluster != s {
+		d = newClusterDiscovery(s)
+		k.discovery[server] = d
+	}
+	return d, nil
+}
+
+// InvalidateDiscovery drops the cached discovery of the cluster, it's called
+// once its CRDs changed here and on demand for the ones changed elsewhere.
+func (k *KubeAPI) InvalidateDiscovery(server string) {
+	d, err := k.discoveryFor(server)
+	if err != nil {
+		slog.Warn("invalidate discovery", "server", server, "err", err.Error())
+		return
+	}
+	d.mapper.Reset()
+}
+
+// ResolveResource fills in the resource of the kind, or the kind of the
+// resource name when the kind is empty, along with the scope. An empty
+// version picks the preferred one. A miss refreshes the cache once, the
+// resource may come from a CRD created since it was filled.
+func (k *KubeAPI) ResolveResource(server string, res *model.APIResource) error {
+	d, err := k.discoveryFor(server)
+	if err != nil {
+		return err
+	}
+	mapping, err := d.mapping(*res)
+	if meta.IsNoMatchError(err) && d.refreshAfterMiss(time.Now()) {
+		mapping, err = d.mapping(*res)
+	}
+	if err != nil {
+		return err
+	}
+	gvk := mapping.GroupVersionKind
+	res.Group, res.Version, res.Kind = gvk.Group, gvk.Version, gvk.Kind
+	res.Resource = mapping.Resource.Resource
+	res.APIVersion = gvk.GroupVersion().String()
+	res.Namespaced = mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	return nil
+}
+
+// ExpandCategory returns the resources of the category, like all or
+// api-extensions.
+func (k *KubeAPI) ExpandCategory(server, category string) ([]model.APIResource, error) {
+	d, err := k.discoveryFor(server)
+	if err != nil {
+		return nil, err
+	}
+	groupResources, ok := d.categories.Expand(category)
+	if !ok && d.refreshAfterMiss(time.Now()) {
+		groupResources, ok = d.categories.Expand(category)
+	}
+	if !ok {
+		return nil, fmt.Errorf("category %s not found", category)
+	}
+	result := make([]model.APIResource, 0, len(groupResources))
+	for _, gr := range groupResources {
+		res := model.APIResource{Group: gr.Group, Resource: gr.Resource}
+		if err := k.ResolveResource(server, &res); err != nil {
+			// the category may list resources this version doesn't serve
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, res)
+	}
+	return result, nil
+}
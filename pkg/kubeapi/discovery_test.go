@@ -0,0 +1,88 @@
+package kubeapi
+
+import (
+	"testing"
+	"time"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/model"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestResolveResource(t *testing.T) {
+	apps := &metav1.APIResourceList{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}, Categories: []string{"all"}},
+			{Name: "deployments/scale", Kind: "Scale", Namespaced: true},
+		},
+	}
+	core := &metav1.APIResourceList{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "nodes", SingularName: "node", Kind: "Node", ShortNames: []string{"no"}},
+		},
+	}
+	first := &fakediscovery.FakeDiscovery{Fake: &ktesting.Fake{Resources: []*metav1.APIResourceList{apps, core}}}
+	second := &fakediscovery.FakeDiscovery{Fake: &ktesting.Fake{Resources: []*metav1.APIResourceList{core}}}
+	k := &KubeAPI{
+		clusters: map[string]*config.Cluster{
+			"first":  {Name: "first", Discovery: first},
+			"second": {Name: "second", Discovery: second},
+		},
+		discovery: map[string]*clusterDiscovery{},
+	}
+
+	res := model.APIResource{Group: "apps", Version: "v1", Kind: "Deployment"}
+	if err := k.ResolveResource("first", &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Resource != "deployments" || !res.Namespaced || res.APIVersion != "apps/v1" {
+		t.Fatalf("unexpected resource %+v", res)
+	}
+	res = model.APIResource{Resource: "no"}
+	if err := k.ResolveResource("second", &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Kind != "Node" || res.Resource != "nodes" || res.Namespaced {
+		t.Fatalf("unexpected short name resource %+v", res)
+	}
+	// the lookups of one cluster must not leak into another
+	res = model.APIResource{Group: "apps", Version: "v1", Kind: "Deployment"}
+	if err := k.ResolveResource("second", &res); err == nil {
+		t.Fatal("second cluster has no deployments")
+	}
+
+	all, err := k.ExpandCategory("first", "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Kind != "Deployment" {
+		t.Fatalf("unexpected category resources %+v", all)
+	}
+
+	// a CRD created after the cache was filled is found on the next miss
+	first.Resources = append(first.Resources, &metav1.APIResourceList{
+		GroupVersion: "shop.io/v1",
+		APIResources: []metav1.APIResource{{Name: "carts", SingularName: "cart", Kind: "Cart", Namespaced: true}},
+	})
+	k.discovery["first"].refreshed = time.Time{}
+	res = model.APIResource{Group: "shop.io", Kind: "Cart"}
+	if err := k.ResolveResource("first", &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Resource != "carts" || res.Version != "v1" {
+		t.Fatalf("unexpected custom resource %+v", res)
+	}
+
+	// a CRD deleted elsewhere stays cached until the cache is invalidated
+	first.Resources = first.Resources[:len(first.Resources)-1]
+	k.InvalidateDiscovery("first")
+	res = model.APIResource{Group: "shop.io", Kind: "Cart"}
+	if err := k.ResolveResource("first", &res); err == nil {
+		t.Fatal("the deleted CRD is still mapped")
+	}
+}
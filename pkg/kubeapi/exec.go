@@ -0,0 +1,66 @@
+package kubeapi
+
+import (
+	"context"
+
+	"teleskopio/pkg/model"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// defaultShell prefers bash, the minimal images only have sh.
+var defaultShell = []string{"/bin/sh", "-c", "command -v bash >/dev/null && exec bash || exec sh"}
+
+// Exec runs the command in the container and streams it until the command
+// exits or ctx is done. The websocket protocol is used when the api server
+// supports it, SPDY otherwise.
+func (k *KubeAPI) Exec(ctx context.Context, req model.ExecRequest, streams remotecommand.StreamOptions) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return err
+	}
+	command := req.Command
+	if len(command) == 0 {
+		command = defaultShell
+	}
+	execReq := server.Typed.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(req.Namespace).
+		Name(req.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: req.Container,
+			Command:   command,
+			Stdin:     streams.Stdin != nil,
+			Stdout:    streams.Stdout != nil,
+			Stderr:    streams.Stderr != nil && !req.TTY,
+			TTY:       req.TTY,
+		}, scheme.ParameterCodec)
+	if req.TTY {
+		// the terminal merges stderr into stdout
+		streams.Stderr = nil
+	}
+	streams.Tty = req.TTY
+
+	websocketExec, err := remotecommand.NewWebSocketExecutor(server.RestConfig, "GET", execReq.URL().String())
+	if err != nil {
+		return err
+	}
+	spdyExec, err := remotecommand.NewSPDYExecutor(server.RestConfig, "POST", execReq.URL())
+	if err != nil {
+		return err
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return err
+	}
+	return executor.StreamWithContext(ctx, streams)
+}
@@ -0,0 +1,70 @@
+package kubeapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	icache "teleskopio/pkg/cache"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kcache "k8s.io/client-go/tools/cache"
+)
+
+// helmSyncTimeout bounds the wait for the first list of the helm informer.
+const helmSyncTimeout = 30 * time.Second
+
+// helm stores every release revision in a secret of this type
+const helmReleaseSelector = "type=helm.sh/release.v1"
+
+var secretsGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+func (k *KubeAPI) helmKey(ctx context.Context, server, namespace string) icache.InformerKey {
+	return icache.InformerKey{
+		Server:        server,
+		GVR:           secretsGVR,
+		Namespace:     namespace,
+		FieldSelector: helmReleaseSelector,
+		User:          k.Impersonated(ctx),
+	}
+}
+
+// WatchHelmReleases starts the informer of the helm release secrets of the
+// namespace, of every namespace of the cluster when it's empty. It's shared
+// like the other informers and runs as long as somebody is subscribed to
+// topics.
+func (k *KubeAPI) WatchHelmReleases(ctx context.Context, server, namespace string, topics []string, handler kcache.ResourceEventHandler) error {
+	s, err := k.clientFor(ctx, server)
+	if err != nil {
+		return err
+	}
+	return k.informers.Start(k.helmKey(ctx, server, namespace), s.Dynamic, topics, handler)
+}
+
+// HelmReleaseSecrets returns the secrets of every release revision from the
+// informer started by WatchHelmReleases, it waits for the informer to sync.
+// It fails at once when the user is forbidden to list the secrets.
+func (k *KubeAPI) HelmReleaseSecrets(ctx context.Context, server, namespace string) ([]unstructured.Unstructured, error) {
+	key := k.helmKey(ctx, server, namespace)
+	ctx, cancel := context.WithTimeout(ctx, helmSyncTimeout)
+	defer cancel()
+	var items []unstructured.Unstructured
+	err := wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(context.Context) (bool, error) {
+		if err := k.informers.Err(key); err != nil {
+			return false, err
+		}
+		var synced bool
+		items, _, synced = k.informers.List(key)
+		return synced, nil
+	})
+	if apierrors.IsForbidden(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("helm releases of %s are not synced: %w", server, err)
+	}
+	return items, nil
+}
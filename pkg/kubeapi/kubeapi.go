@@ -1,15 +1,19 @@
 package kubeapi
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	icache "teleskopio/pkg/cache"
 	"teleskopio/pkg/config"
 	"teleskopio/pkg/model"
 
@@ -23,38 +27,91 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	k8sYAML "k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	kcache "k8s.io/client-go/tools/cache"
 
 	"github.com/patrickmn/go-cache"
 )
 
+// continue tokens of the lists served from the informers cache
+const cacheContinuePrefix = "cache-"
+
 type KubeAPI struct {
-	clusters map[string]*config.Cluster
-	cache    *cache.Cache
+	mu            sync.RWMutex
+	clusters      map[string]*config.Cluster
+	runtime       map[string]bool
+	discovery     map[string]*clusterDiscovery
+	informers     *icache.DynamicInformers
+	listFromCache bool
+	impersonate   bool
+	fieldManager  string
+	userClients   *cache.Cache
+
+	forwardsMu     sync.Mutex
+	forwards       map[string]*portForward
+	forwardAddress string
 }
 
-func New(clusters []*config.Cluster) *KubeAPI {
+func New(cfg *config.Config, clusters []*config.Cluster) *KubeAPI {
 	clustersMap := map[string]*config.Cluster{}
 	for _, c := range clusters {
-		clustersMap[c.Address] = c
+		clustersMap[c.Name] = c
 	}
 	return &KubeAPI{
-		clusters: clustersMap,
-		// TODO longer expiration?
-		cache: cache.New(1*time.Minute, 10*time.Minute),
+		clusters:      clustersMap,
+		runtime:       map[string]bool{},
+		discovery:     map[string]*clusterDiscovery{},
+		informers:     icache.NewDynamicInformers(*cfg.Kube.Cache.IdleTimeout),
+		listFromCache: cfg.Kube.Cache.List,
+		impersonate:   cfg.Kube.Impersonate,
+		fieldManager:  cfg.Kube.FieldManager,
+		userClients:   cache.New(30*time.Minute, time.Hour),
+
+		forwards:       map[string]*portForward{},
+		forwardAddress: cfg.Kube.PortForward,
 	}
 }
 
+// Run stops idle informers, it blocks forever.
+func (k *KubeAPI) Run() {
+	k.informers.Run()
+}
+
+// Impersonate reports whether the requests are made as the logged in user.
+func (k *KubeAPI) Impersonate() bool {
+	return k.impersonate
+}
+
+// Informers - shared informers used by watchers and cached lists
+func (k *KubeAPI) Informers() *icache.DynamicInformers {
+	return k.informers
+}
+
 func (k *KubeAPI) GetClusters() []model.Cluster {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	configs := []model.Cluster{}
-	for _, k := range k.clusters {
-		configs = append(configs, model.Cluster{Server: k.Address})
+	for _, c := range k.clusters {
+		configs = append(configs, model.Cluster{Server: c.Name, Name: c.Name, Address: c.Address, Labels: c.Labels})
 	}
+	slices.SortFunc(configs, func(a, b model.Cluster) int {
+		return strings.Compare(a.Name, b.Name)
+	})
 	return configs
 }
 
+// Address returns the api server address of the cluster name.
+func (k *KubeAPI) Address(name string) string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if c, ok := k.clusters[name]; ok {
+		return c.Address
+	}
+	return ""
+}
+
 func (k *KubeAPI) GetVersion(req model.PayloadRequest) (*version.Info, error) {
 	if err := req.Validate(); err != nil {
 		return nil, err
@@ -63,7 +120,7 @@ func (k *KubeAPI) GetVersion(req model.PayloadRequest) (*version.Info, error) {
 	if err != nil {
 		return nil, err
 	}
-	ver, err := server.Typed.Discovery().ServerVersion()
+	ver, err := server.Discovery.ServerVersion()
 	return ver, err
 }
 
@@ -71,7 +128,9 @@ func (k *KubeAPI) ListCustomResourceDefinitions(ctx context.Context, req model.P
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
-	server, err := k.getClient(req.Server)
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
 	if err != nil {
 		return nil, err
 	}
@@ -82,14 +141,16 @@ func (k *KubeAPI) ListCustomResourceDefinitions(ctx context.Context, req model.P
 	return crdList, nil
 }
 
+// ListResources refreshes the discovery cache of the cluster, it's how new
+// CRDs show up without waiting for a lookup to miss them.
 // TODO filter here
 func (k *KubeAPI) ListResources(s string) ([]model.APIResource, error) {
-	server, err := k.getClient(s)
+	d, err := k.discoveryFor(s)
 	if err != nil {
 		return nil, err
 	}
-	discoveryClient := server.Typed.Discovery()
-	apiGroupResources, err := discoveryClient.ServerPreferredResources()
+	d.mapper.Reset()
+	apiGroupResources, err := d.client.ServerPreferredResources()
 	if err != nil {
 		return nil, err
 	}
@@ -121,10 +182,21 @@ func (k *KubeAPI) ListDynamicResource(ctx context.Context, req model.ListRequest
 	if err := req.Validate(); err != nil {
 		return nil, "", "", err
 	}
-	ri, err := k.GetResourceInterface(req.Server, req.Namespace, &req.APIResource)
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	ri, err := k.GetResourceInterface(ctx, req.Server, req.Namespace, &req.APIResource)
 	if err != nil {
 		return nil, "", "", err
 	}
+	if k.listFromCache {
+		if items, continueToken, resourceVersion, ok := k.listCachedResource(req, k.Impersonated(ctx)); ok {
+			return items, continueToken, resourceVersion, nil
+		}
+	}
+	// the cached list is gone, start over from the api server
+	if strings.HasPrefix(req.Continue, cacheContinuePrefix) {
+		req.Continue = ""
+	}
 	list, err := ri.List(ctx, metav1.ListOptions{
 		Limit:    req.Limit,
 		Continue: req.Continue,
@@ -150,11 +222,86 @@ func (k *KubeAPI) ListDynamicResource(ctx context.Context, req model.ListRequest
 	return list.Items, continueToken, resourceVersion, nil
 }
 
+// listCachedResource pages through the informer store, the namespaced request
+// falls back to the cluster wide informer.
+func (k *KubeAPI) listCachedResource(req model.ListRequest, user string) ([]unstructured.Unstructured, string, string, bool) {
+	if req.Continue != "" && !strings.HasPrefix(req.Continue, cacheContinuePrefix) {
+		return nil, "", "", false
+	}
+	key := icache.InformerKey{Server: req.Server, GVR: req.APIResource.GetGVR(), Namespace: req.Namespace, User: user}
+	items, resourceVersion, ok := k.informers.List(key)
+	if !ok && req.Namespace != "" {
+		key.Namespace = ""
+		items, resourceVersion, ok = k.informers.List(key)
+		items = slices.DeleteFunc(items, func(u unstructured.Unstructured) bool {
+			return u.GetNamespace() != req.Namespace
+		})
+	}
+	if !ok {
+		return nil, "", "", false
+	}
+	slices.SortFunc(items, func(a, b unstructured.Unstructured) int {
+		if c := strings.Compare(a.GetNamespace(), b.GetNamespace()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	offset, err := strconv.Atoi(strings.TrimPrefix(req.Continue, cacheContinuePrefix))
+	if err != nil || offset > len(items) {
+		offset = 0
+	}
+	end := len(items)
+	if req.Limit > 0 && offset+int(req.Limit) < end {
+		end = offset + int(req.Limit)
+	}
+	continueToken := ""
+	if end < len(items) {
+		continueToken = fmt.Sprintf("%s%d", cacheContinuePrefix, end)
+	}
+	page := items[offset:end]
+	for i := range page {
+		page[i].SetAPIVersion(req.APIResource.Version)
+		if req.APIResource.Group != "" {
+			page[i].SetAPIVersion(fmt.Sprintf("%s/%s", req.APIResource.Group, req.APIResource.Version))
+		}
+		page[i].SetKind(req.APIResource.Kind)
+	}
+	return page, continueToken, resourceVersion, true
+}
+
+// WatchDynamicResource starts the shared informer of the resource, handler
+// publishes to topics which keep the informer running.
+func (k *KubeAPI) WatchDynamicResource(
+	ctx context.Context,
+	req model.WatchRequest,
+	fieldSelector string,
+	topics []string,
+	handler kcache.ResourceEventHandler,
+) error {
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return err
+	}
+	if err := k.ResolveResource(req.Server, &req.APIResource); err != nil {
+		return err
+	}
+	key := icache.InformerKey{
+		Server:        req.Server,
+		GVR:           req.APIResource.GetGVR(),
+		Namespace:     req.Namespace,
+		FieldSelector: fieldSelector,
+		User:          k.Impersonated(ctx),
+	}
+	return k.informers.Start(key, server.Dynamic, topics, handler)
+}
+
 func (k *KubeAPI) ListEventsDynamicResource(ctx context.Context, req model.ListRequest) ([]unstructured.Unstructured, string, string, error) {
 	if err := req.Validate(); err != nil {
 		return nil, "", "", err
 	}
-	ri, err := k.GetResourceInterface(req.Server, req.Namespace, &req.APIResource)
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	ri, err := k.GetResourceInterface(ctx, req.Server, req.Namespace, &req.APIResource)
 	if err != nil {
 		return nil, "", "", err
 	}
@@ -197,7 +344,9 @@ func (k *KubeAPI) GetDynamicResource(ctx context.Context, req model.GetRequest)
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
-	ri, err := k.GetResourceInterface(req.Server, req.Namespace, &req.APIResource)
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	ri, err := k.GetResourceInterface(ctx, req.Server, req.Namespace, &req.APIResource)
 	if err != nil {
 		return nil, err
 	}
@@ -205,81 +354,21 @@ func (k *KubeAPI) GetDynamicResource(ctx context.Context, req model.GetRequest)
 	return res, err
 }
 
-func (k *KubeAPI) CreateOrUpdateKubeResource(ctx context.Context, req model.ObjectRequest, op string) (*unstructured.Unstructured, error) {
-	if err := req.Validate(); err != nil {
-		return nil, err
-	}
-	server, err := k.getClient(req.Server)
-	if err != nil {
-		return nil, err
-	}
-	decoder := k8sYAML.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(req.Yaml)), 1024)
-	obj := &unstructured.Unstructured{}
-	if err := decoder.Decode(obj); err != nil && err != io.EOF {
-		return nil, err
-	}
-
-	gvk := obj.GroupVersionKind()
-
-	apiResList, err := server.Typed.ServerResourcesForGroupVersion(schema.GroupVersion{
-		Group:   gvk.Group,
-		Version: gvk.Version,
-	}.String())
-	if err != nil {
-		return nil, err
-	}
-
-	var plural string
-	for _, res := range apiResList.APIResources {
-		if res.Kind == gvk.Kind {
-			plural = res.Name
-			break
-		}
-	}
-	if plural == "" {
-		return nil, fmt.Errorf("resource kind %s not found in API group %s/%s", gvk.Kind, gvk.Group, gvk.Version)
-	}
-
-	gvr := schema.GroupVersionResource{
-		Group:    gvk.Group,
-		Version:  gvk.Version,
-		Resource: plural,
-	}
-
-	ns := obj.GetNamespace()
-	var ri dynamic.ResourceInterface
-	if ns != "" {
-		ri = server.Dynamic.Resource(gvr).Namespace(ns)
-	} else {
-		ri = server.Dynamic.Resource(gvr)
-	}
-
-	var result *unstructured.Unstructured
-	switch op {
-	case "create":
-		result, err = ri.Create(ctx, obj, metav1.CreateOptions{})
-	case "update":
-		result, err = ri.Update(ctx, obj, metav1.UpdateOptions{})
-	}
-	return result, err
-}
-
 func (k *KubeAPI) TriggerCronjob(ctx context.Context, req model.TriggerCronjob) (string, error) {
 	if err := req.Validate(); err != nil {
 		return "", err
 	}
-	server, err := k.getClient(req.Server)
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
 	if err != nil {
 		return "", err
 	}
 
-	apiResourceList, err := k.GetResource(req.Server, req.APIResource)
-	if err != nil {
+	if err := k.ResolveResource(req.Server, &req.APIResource); err != nil {
 		return "", err
 	}
 
-	k.SetResource(&req.APIResource, apiResourceList)
-
 	cronJob, err := server.Typed.BatchV1().CronJobs(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
 	if err != nil {
 		return "", err
@@ -304,17 +393,16 @@ func (k *KubeAPI) ScaleResource(ctx context.Context, req model.ResourceOperation
 	if err := req.Validate(); err != nil {
 		return err
 	}
-	server, err := k.getClient(req.Server)
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
 	if err != nil {
 		return err
 	}
 
-	apiResourceList, err := k.GetResource(req.Server, req.APIResource)
-	if err != nil {
+	if err := k.ResolveResource(req.Server, &req.APIResource); err != nil {
 		return err
 	}
-
-	k.SetResource(&req.APIResource, apiResourceList)
 	gvr := req.APIResource.GetGVR()
 	resource, err := server.Dynamic.Resource(gvr).
 		Namespace(req.Namespace).
@@ -338,17 +426,16 @@ func (k *KubeAPI) DeleteDynamicResources(ctx context.Context, req model.DeleteRe
 	if err := req.Validate(); err != nil {
 		return err
 	}
-	server, err := k.getClient(req.Server)
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
 	if err != nil {
 		return err
 	}
 
-	apiResourceList, err := k.GetResource(req.Server, req.APIResource)
-	if err != nil {
+	if err := k.ResolveResource(req.Server, &req.APIResource); err != nil {
 		return err
 	}
-
-	k.SetResource(&req.APIResource, apiResourceList)
 	gvr := req.APIResource.GetGVR()
 	if req.APIResource.Namespaced {
 		for _, res := range req.Resources {
@@ -363,6 +450,9 @@ func (k *KubeAPI) DeleteDynamicResources(ctx context.Context, req model.DeleteRe
 			}
 		}
 	}
+	if gvr.GroupResource() == crdResource {
+		k.InvalidateDiscovery(req.Server)
+	}
 	return nil
 }
 
@@ -370,7 +460,7 @@ func (k *KubeAPI) GetPodLogsReader(ctx context.Context, req model.PodLogRequest,
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
-	server, err := k.getClient(req.Server)
+	server, err := k.clientFor(ctx, req.Server)
 	if err != nil {
 		return nil, err
 	}
@@ -381,17 +471,16 @@ func (k *KubeAPI) GetPodLogsReader(ctx context.Context, req model.PodLogRequest,
 }
 
 func (k *KubeAPI) NodeOperation(ctx context.Context, req model.NodeOperation) error {
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
 	// TODO validate
-	server, err := k.getClient(req.Server)
+	server, err := k.clientFor(ctx, req.Server)
 	if err != nil {
 		return err
 	}
-	apiResourceList, err := k.GetResource(req.Server, req.APIResource)
-	if err != nil {
+	if err := k.ResolveResource(req.Server, &req.APIResource); err != nil {
 		return err
 	}
-
-	k.SetResource(&req.APIResource, apiResourceList)
 	ri := server.Dynamic.Resource(req.APIResource.GetGVR())
 
 	payload := []struct {
@@ -413,7 +502,7 @@ func (k *KubeAPI) NodeOperation(ctx context.Context, req model.NodeOperation) er
 
 func (k *KubeAPI) NodeDrain(ctx context.Context, req model.NodeDrain, onDelete func(pod *corev1.Pod, usingEviction bool)) (*corev1.Node, error) {
 	// TODO validate
-	server, err := k.getClient(req.Server)
+	server, err := k.clientFor(ctx, req.Server)
 	if err != nil {
 		return nil, err
 	}
@@ -438,40 +527,72 @@ func (k *KubeAPI) NodeDrain(ctx context.Context, req model.NodeDrain, onDelete f
 	return node, drain.RunNodeDrain(drainer, req.ResourceName)
 }
 
-func (k *KubeAPI) SetResource(req *model.APIResource, apiResourceList *metav1.APIResourceList) {
-	for _, r := range apiResourceList.APIResources {
-		if r.Kind == req.Kind && r.SingularName == strings.ToLower(req.Kind) {
-			req.Resource = r.Name
-		}
+// WithTimeout bounds the context with the api request timeout of the cluster.
+func (k *KubeAPI) WithTimeout(ctx context.Context, server string) (context.Context, context.CancelFunc) {
+	s, err := k.getClient(server)
+	if err != nil || s.Timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, s.Timeout)
 }
 
-func (k *KubeAPI) GetResource(server string, req model.APIResource) (*metav1.APIResourceList, error) {
+// GetClient - the clients acting as the user of the context
+func (k *KubeAPI) GetClient(ctx context.Context, server string) (*config.Cluster, error) {
+	return k.clientFor(ctx, server)
+}
+
+// Impersonated returns the user the requests of the context are made as,
+// empty when teleskopio uses its own identity.
+func (k *KubeAPI) Impersonated(ctx context.Context) string {
+	claims, ok := model.ClaimsFromContext(ctx)
+	if !k.impersonate || !ok {
+		return ""
+	}
+	return strings.Join(append([]string{claims.Username}, claims.Groups...), ",")
+}
+
+// clientFor impersonates the user of the context when it's enabled, clients
+// are cached per cluster and user. The system: users and groups are never
+// impersonated, they belong to kubernetes.
+func (k *KubeAPI) clientFor(ctx context.Context, server string) (*config.Cluster, error) {
 	s, err := k.getClient(server)
 	if err != nil {
 		return nil, err
 	}
-	apiResourceList, found := k.cache.Get("apiResourceList")
-	if !found {
-		apiResourceList, err := s.Typed.ServerResourcesForGroupVersion(schema.GroupVersion{
-			Group:   req.Group,
-			Version: req.Version,
-		}.String())
-		if err != nil {
-			return nil, err
-		}
-		k.cache.Set("apiResourceList", apiResourceList, cache.DefaultExpiration)
-		return apiResourceList, nil
+	claims, ok := model.ClaimsFromContext(ctx)
+	if !k.impersonate || !ok {
+		return s, nil
+	}
+	if reserved(claims.Username) || slices.ContainsFunc(claims.Groups, reserved) {
+		return nil, fmt.Errorf("impersonate %s: %w", claims.Username, errReservedName)
+	}
+	key := server + "|" + k.Impersonated(ctx)
+	if c, found := k.userClients.Get(key); found {
+		return c.(*config.Cluster), nil
+	}
+	restCfg := rest.CopyConfig(s.RestConfig)
+	restCfg.Impersonate = rest.ImpersonationConfig{
+		UserName: claims.Username,
+		Groups:   claims.Groups,
 	}
-	return apiResourceList.(*metav1.APIResourceList), nil
+	c, err := config.NewCluster(restCfg, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c.Name, c.Labels = s.Name, s.Labels
+	k.userClients.SetDefault(key, c)
+	return c, nil
 }
 
-// GetClient - just a wrapper
-func (k *KubeAPI) GetClient(server string) (*config.Cluster, error) {
-	return k.getClient(server)
+var errReservedName = errors.New("the system: users and groups are not impersonated")
+
+func reserved(name string) bool {
+	return strings.HasPrefix(name, "system:")
 }
 
 func (k *KubeAPI) getClient(server string) (*config.Cluster, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	s, found := k.clusters[server]
 	if found {
 		return s, nil
@@ -479,16 +600,14 @@ func (k *KubeAPI) getClient(server string) (*config.Cluster, error) {
 	return nil, fmt.Errorf("server %s not found", server)
 }
 
-func (k *KubeAPI) GetResourceInterface(server, ns string, resource *model.APIResource) (dynamic.ResourceInterface, error) {
-	s, err := k.getClient(server)
+func (k *KubeAPI) GetResourceInterface(ctx context.Context, server, ns string, resource *model.APIResource) (dynamic.ResourceInterface, error) {
+	s, err := k.clientFor(ctx, server)
 	if err != nil {
 		return nil, err
 	}
-	apiResourceList, err := k.GetResource(server, *resource)
-	if err != nil {
+	if err := k.ResolveResource(server, resource); err != nil {
 		return nil, err
 	}
-	k.SetResource(resource, apiResourceList)
 	gvr := resource.GetGVR()
 
 	var ri dynamic.ResourceInterface
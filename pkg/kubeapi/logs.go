@@ -0,0 +1,303 @@
+package kubeapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/logfilter"
+	"teleskopio/pkg/model"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// maxLogLine is the longest line read from a container, longer lines end the
+// stream of the container.
+const maxLogLine = 1024 * 1024
+
+// reattachDelay is the pause before a stream that ended while its container
+// is still running is attached again.
+const reattachDelay = time.Second
+
+// StreamLogs follows the logs of every container of the selected pods until
+// ctx is done. New pods and restarted containers are attached as they start,
+// the streams of the deleted pods are closed.
+func (k *KubeAPI) StreamLogs(ctx context.Context, req model.LogStreamRequest, emit func(model.LogLine)) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	var filter *logfilter.Filter
+	if req.Filter != nil {
+		var err error
+		if filter, err = logfilter.New(*req.Filter, req.Timestamps); err != nil {
+			return err
+		}
+	}
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return err
+	}
+	opts, err := k.podSelector(ctx, server, req)
+	if err != nil {
+		return err
+	}
+	pods := server.Typed.CoreV1().Pods(req.Namespace)
+	lw := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector, options.FieldSelector = opts.LabelSelector, opts.FieldSelector
+			return pods.List(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector, options.FieldSelector = opts.LabelSelector, opts.FieldSelector
+			return pods.Watch(ctx, options)
+		},
+	}
+	t := &logTail{
+		server:  server,
+		req:     req,
+		filter:  filter,
+		emit:    emit,
+		started: time.Now(),
+		streams: map[string]context.CancelFunc{},
+		ended:   map[string]time.Time{},
+	}
+	defer t.stopAll()
+	_, err = watchtools.UntilWithSync(ctx, lw, &corev1.Pod{}, nil, func(e watch.Event) (bool, error) {
+		pod, ok := e.Object.(*corev1.Pod)
+		if !ok {
+			return false, nil
+		}
+		if e.Type == watch.Deleted {
+			t.stopPod(pod.Name)
+			return false, nil
+		}
+		t.attach(ctx, pod)
+		return false, nil
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// podSelector returns the selectors of the pods of the request, the ones of
+// a workload are read from its spec.
+func (k *KubeAPI) podSelector(ctx context.Context, server *config.Cluster, req model.LogStreamRequest) (metav1.ListOptions, error) {
+	var gvr schema.GroupVersionResource
+	switch req.Kind {
+	case "":
+		return metav1.ListOptions{LabelSelector: req.Selector}, nil
+	case "Pod":
+		return metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", req.Name).String()}, nil
+	case "Job":
+		gvr = batchv1.SchemeGroupVersion.WithResource("jobs")
+	default:
+		gvr = appsv1.SchemeGroupVersion.WithResource(strings.ToLower(req.Kind) + "s")
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	obj, err := server.Dynamic.Resource(gvr).Namespace(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	if err != nil {
+		return metav1.ListOptions{}, err
+	}
+	m, found, err := unstructured.NestedMap(obj.Object, "spec", "selector")
+	if err != nil || !found {
+		return metav1.ListOptions{}, fmt.Errorf("%s %s has no selector", req.Kind, req.Name)
+	}
+	var ls metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &ls); err != nil {
+		return metav1.ListOptions{}, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&ls)
+	if err != nil {
+		return metav1.ListOptions{}, err
+	}
+	return metav1.ListOptions{LabelSelector: selector.String()}, nil
+}
+
+// logTail keeps a stream per running container, keyed by pod/container.
+type logTail struct {
+	server  *config.Cluster
+	req     model.LogStreamRequest
+	filter  *logfilter.Filter
+	emit    func(model.LogLine)
+	started time.Time
+
+	mu      sync.Mutex
+	streams map[string]context.CancelFunc
+	// ended - the end of the last stream of the container, a restarted
+	// container is read from there
+	ended map[string]time.Time
+}
+
+func (t *logTail) attach(ctx context.Context, pod *corev1.Pod) {
+	statuses := slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, status := range statuses {
+		if status.State.Running == nil || (t.req.Container != "" && status.Name != t.req.Container) {
+			continue
+		}
+		key := pod.Name + "/" + status.Name
+		if _, streaming := t.streams[key]; streaming {
+			continue
+		}
+		opts := &corev1.PodLogOptions{Container: status.Name, Follow: true, Timestamps: t.req.Timestamps}
+		switch ended, restarted := t.ended[key]; {
+		case restarted:
+			since := metav1.NewTime(ended)
+			opts.SinceTime = &since
+		case pod.CreationTimestamp.Time.Before(t.started):
+			// running before the stream started, only the tail is new
+			opts.TailLines, opts.SinceSeconds = t.req.TailLines, t.req.SinceSeconds
+			if t.req.SinceTime != nil {
+				opts.SinceTime = &metav1.Time{Time: *t.req.SinceTime}
+			}
+			if opts.TailLines == nil && opts.SinceSeconds == nil && opts.SinceTime == nil {
+				opts.SinceTime = &metav1.Time{Time: t.started}
+			}
+		}
+		streamCtx, cancel := context.WithCancel(ctx)
+		t.streams[key] = cancel
+		go t.follow(streamCtx, key, pod.Name, opts)
+	}
+}
+
+// follow reads the logs of the container until ctx is done or the container
+// stops. A stream ending while the container still runs, like one closed by
+// the API server, is attached again from the timestamp of its last line.
+func (t *logTail) follow(ctx context.Context, key, pod string, opts *corev1.PodLogOptions) {
+	defer func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if cancel, ok := t.streams[key]; ok {
+			cancel()
+			delete(t.streams, key)
+			t.ended[key] = time.Now()
+		}
+	}()
+	line := model.LogLine{
+		Cluster:   t.req.Server,
+		Namespace: t.req.Namespace,
+		Pod:       pod,
+		Container: opts.Container,
+	}
+	var grep *logfilter.Grep
+	if t.filter != nil {
+		grep = t.filter.Grep()
+	}
+	push := func(text string) {
+		if grep == nil {
+			line.Line = text
+			t.emit(line)
+			return
+		}
+		grep.Push(text, func(l logfilter.Line) {
+			line.Line, line.Level, line.Context, line.Gap = l.Text, l.Level, l.Context, l.Gap
+			t.emit(line)
+		})
+	}
+	// the timestamps tell where to attach again, they're cut off the lines
+	// when the request doesn't want them
+	opts.Timestamps = true
+	var last time.Time
+	for {
+		slog.Debug("attach container logs", "cluster", t.req.Server, "pod", pod, "container", opts.Container)
+		var err error
+		if last, err = t.read(ctx, pod, opts, last, push); err != nil {
+			slog.Debug("container logs", "pod", pod, "container", opts.Container, "err", err.Error())
+		}
+		if ctx.Err() != nil || !t.running(ctx, pod, opts.Container) {
+			slog.Debug("detach container logs", "cluster", t.req.Server, "pod", pod, "container", opts.Container)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reattachDelay):
+		}
+		if !last.IsZero() {
+			opts = &corev1.PodLogOptions{Container: opts.Container, Follow: true, Timestamps: true, SinceTime: &metav1.Time{Time: last}}
+		}
+	}
+}
+
+// read pushes the lines of one stream of the container and returns the
+// timestamp of the last one. SinceTime is rounded to the second, the lines up
+// to after were read by the previous stream and are skipped.
+func (t *logTail) read(ctx context.Context, pod string, opts *corev1.PodLogOptions, after time.Time, push func(string)) (time.Time, error) {
+	stream, err := t.server.Typed.CoreV1().Pods(t.req.Namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		return after, err
+	}
+	defer stream.Close()
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLine)
+	for scanner.Scan() {
+		text := scanner.Text()
+		prefix, rest, _ := strings.Cut(text, " ")
+		if at, err := time.Parse(time.RFC3339Nano, prefix); err == nil {
+			if !at.After(after) {
+				continue
+			}
+			after = at
+			if !t.req.Timestamps {
+				text = rest
+			}
+		}
+		push(text)
+	}
+	return after, scanner.Err()
+}
+
+// running reports whether the container of the pod is still running.
+func (t *logTail) running(ctx context.Context, pod, container string) bool {
+	p, err := t.server.Typed.CoreV1().Pods(t.req.Namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	statuses := slices.Concat(p.Status.InitContainerStatuses, p.Status.ContainerStatuses, p.Status.EphemeralContainerStatuses)
+	i := slices.IndexFunc(statuses, func(s corev1.ContainerStatus) bool { return s.Name == container })
+	return i >= 0 && statuses[i].State.Running != nil
+}
+
+func (t *logTail) stopPod(pod string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, cancel := range t.streams {
+		if strings.HasPrefix(key, pod+"/") {
+			cancel()
+			delete(t.streams, key)
+		}
+	}
+	for key := range t.ended {
+		if strings.HasPrefix(key, pod+"/") {
+			delete(t.ended, key)
+		}
+	}
+}
+
+func (t *logTail) stopAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, cancel := range t.streams {
+		cancel()
+		delete(t.streams, key)
+	}
+}
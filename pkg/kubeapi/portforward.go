@@ -0,0 +1,293 @@
+package kubeapi
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/model"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// loopback is the address of the forwards reached through the websocket.
+const loopback = "127.0.0.1"
+
+var ErrPortForwardNotFound = errors.New("port forward not found")
+
+type portForward struct {
+	model.PortForward
+	// session - the token ID of the session that started it
+	session string
+	stop    chan struct{}
+}
+
+// StartPortForward listens on a local port of the teleskopio host and
+// forwards it to the pod, the forward is owned by user and stopped once
+// expires is reached or the session ends, a zero expires keeps it until it's
+// stopped.
+func (k *KubeAPI) StartPortForward(ctx context.Context, req model.PortForwardRequest, user, session string, expires time.Time) (model.PortForward, error) {
+	fwd := model.PortForward{
+		Server:    req.Server,
+		Namespace: req.Namespace,
+		Kind:      req.Kind,
+		Name:      req.Name,
+		Port:      req.Port,
+		Tunnel:    req.Tunnel,
+		User:      user,
+	}
+	if err := req.Validate(); err != nil {
+		return fwd, err
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return fwd, err
+	}
+	fwd.Pod, fwd.PodPort, err = resolvePodPort(ctx, server, req)
+	if err != nil {
+		return fwd, err
+	}
+	dialer, err := portForwardDialer(server, req.Namespace, fwd.Pod)
+	if err != nil {
+		return fwd, err
+	}
+	fwd.Address = k.forwardAddress
+	if req.Tunnel {
+		fwd.Address = loopback
+	}
+	stop, ready := make(chan struct{}), make(chan struct{})
+	pf, err := portforward.NewOnAddresses(
+		dialer,
+		[]string{fwd.Address},
+		[]string{fmt.Sprintf("%d:%d", req.LocalPort, fwd.PodPort)},
+		stop, ready, nil, nil,
+	)
+	if err != nil {
+		return fwd, err
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- pf.ForwardPorts()
+	}()
+	select {
+	case <-ready:
+	case err := <-errCh:
+		return fwd, err
+	case <-ctx.Done():
+		close(stop)
+		return fwd, ctx.Err()
+	}
+	ports, err := pf.GetPorts()
+	if err != nil {
+		close(stop)
+		return fwd, err
+	}
+	fwd.LocalPort = int(ports[0].Local)
+	fwd.ID = rand.Text()
+	fwd.Started = time.Now().UTC()
+
+	k.forwardsMu.Lock()
+	k.forwards[fwd.ID] = &portForward{PortForward: fwd, session: session, stop: stop}
+	k.forwardsMu.Unlock()
+	slog.Info("port forward started", "id", fwd.ID, "pod", fwd.Pod, "port", fwd.PodPort, "local", fwd.LocalPort, "user", user)
+
+	go func() {
+		var expired <-chan time.Time
+		if !expires.IsZero() {
+			timer := time.NewTimer(time.Until(expires))
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case err := <-errCh:
+			// the pod went away or the connection to the api server broke
+			slog.Info("port forward ended", "id", fwd.ID, "err", err)
+		case <-expired:
+			slog.Info("port forward expired", "id", fwd.ID, "user", user)
+		case <-stop:
+			// stopped by stopForwards, it's already forgotten
+			return
+		}
+		k.stopForwards(func(f *portForward) bool { return f.ID == fwd.ID })
+	}()
+	return fwd, nil
+}
+
+// PortForwards lists the forwards of the user.
+func (k *KubeAPI) PortForwards(user string) []model.PortForward {
+	k.forwardsMu.Lock()
+	defer k.forwardsMu.Unlock()
+	forwards := []model.PortForward{}
+	for _, f := range k.forwards {
+		if f.User == user {
+			forwards = append(forwards, f.PortForward)
+		}
+	}
+	slices.SortFunc(forwards, func(a, b model.PortForward) int {
+		return a.Started.Compare(b.Started)
+	})
+	return forwards
+}
+
+// PortForward returns the forward of the user by id.
+func (k *KubeAPI) PortForward(id, user string) (model.PortForward, error) {
+	k.forwardsMu.Lock()
+	defer k.forwardsMu.Unlock()
+	f, found := k.forwards[id]
+	if !found || f.User != user {
+		return model.PortForward{}, ErrPortForwardNotFound
+	}
+	return f.PortForward, nil
+}
+
+// StopPortForward stops the forward of the user by id.
+func (k *KubeAPI) StopPortForward(id, user string) (model.PortForward, error) {
+	fwd, err := k.PortForward(id, user)
+	if err != nil {
+		return fwd, err
+	}
+	k.stopForwards(func(f *portForward) bool { return f.ID == id })
+	return fwd, nil
+}
+
+// StopSessionPortForwards stops the forwards started in the session of the
+// user, the session ended.
+func (k *KubeAPI) StopSessionPortForwards(user, session string) {
+	k.stopForwards(func(f *portForward) bool { return f.User == user && f.session == session })
+}
+
+func (k *KubeAPI) stopForwards(match func(f *portForward) bool) {
+	k.forwardsMu.Lock()
+	defer k.forwardsMu.Unlock()
+	for id, f := range k.forwards {
+		if match(f) {
+			delete(k.forwards, id)
+			close(f.stop)
+			slog.Info("port forward stopped", "id", id, "pod", f.Pod, "user", f.User)
+		}
+	}
+}
+
+// resolvePodPort returns the pod and its port behind the request, a service
+// port is mapped to the target port of a ready pod of the service.
+func resolvePodPort(ctx context.Context, server *config.Cluster, req model.PortForwardRequest) (string, int, error) {
+	pods := server.Typed.CoreV1().Pods(req.Namespace)
+	if req.Kind == "Pod" {
+		pod, err := pods.Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", 0, err
+		}
+		if pod.Status.Phase != corev1.PodRunning {
+			return "", 0, fmt.Errorf("pod %s is %s", pod.Name, pod.Status.Phase)
+		}
+		return pod.Name, req.Port, nil
+	}
+	svc, err := server.Typed.CoreV1().Services(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s has no selector", svc.Name)
+	}
+	i := slices.IndexFunc(svc.Spec.Ports, func(p corev1.ServicePort) bool { return int(p.Port) == req.Port })
+	if i < 0 {
+		return "", 0, fmt.Errorf("service %s has no port %d", svc.Name, req.Port)
+	}
+	target := svc.Spec.Ports[i].TargetPort
+	list, err := pods.List(ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String()})
+	if err != nil {
+		return "", 0, err
+	}
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if !podReady(pod) {
+			continue
+		}
+		port, err := containerPort(pod, target, req.Port)
+		if err != nil {
+			return "", 0, err
+		}
+		return pod.Name, port, nil
+	}
+	return "", 0, fmt.Errorf("service %s has no ready pod", svc.Name)
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	return slices.ContainsFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool {
+		return c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue
+	})
+}
+
+// containerPort resolves a target port, the named ones are looked up in the
+// containers of the pod and an empty one is the service port.
+func containerPort(pod *corev1.Pod, target intstr.IntOrString, port int) (int, error) {
+	if target.Type == intstr.Int {
+		if target.IntVal == 0 {
+			return port, nil
+		}
+		return int(target.IntVal), nil
+	}
+	if n, err := strconv.Atoi(target.StrVal); err == nil {
+		return n, nil
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == target.StrVal {
+				return int(p.ContainerPort), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("pod %s has no port named %s", pod.Name, target.StrVal)
+}
+
+// portForwardDialer prefers the websocket protocol, SPDY is the fallback of
+// the api servers that don't support it.
+func portForwardDialer(server *config.Cluster, namespace, pod string) (httpstream.Dialer, error) {
+	u := server.Typed.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward").
+		URL()
+	transport, upgrader, err := spdy.RoundTripperFor(server.RestConfig)
+	if err != nil {
+		return nil, err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, u)
+	tunneling, err := portforward.NewSPDYOverWebsocketDialer(u, server.RestConfig)
+	if err != nil {
+		return nil, err
+	}
+	return portforward.NewFallbackDialer(tunneling, dialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	}), nil
+}
+
+// DialPortForward connects to the local port of a tunnel forward.
+func (k *KubeAPI) DialPortForward(ctx context.Context, id, user string) (net.Conn, error) {
+	fwd, err := k.PortForward(id, user)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(fwd.Address, strconv.Itoa(fwd.LocalPort)))
+}
@@ -0,0 +1,36 @@
+package kubeapi
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestContainerPort(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+		{Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}},
+	}}}
+	tests := []struct {
+		name   string
+		target intstr.IntOrString
+		want   int
+		err    bool
+	}{
+		{"empty is the service port", intstr.IntOrString{}, 80, false},
+		{"number", intstr.FromInt32(9090), 9090, false},
+		{"named", intstr.FromString("http"), 8080, false},
+		{"unknown name", intstr.FromString("grpc"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := containerPort(pod, tt.target, 80)
+			if (err != nil) != tt.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
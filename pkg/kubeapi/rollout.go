@@ -0,0 +1,354 @@
+package kubeapi
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/model"
+
+	"gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/polymorphichelpers"
+)
+
+const (
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+	revisionAnnotation    = "deployment.kubernetes.io/revision"
+)
+
+var errNotDeployment = errors.New("only deployments can be paused and resumed")
+
+// RolloutRestart restarts the pods of the workload the way kubectl does, by
+// changing an annotation of the pod template.
+func (k *KubeAPI) RolloutRestart(ctx context.Context, req model.RolloutRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return err
+	}
+	ri := server.Dynamic.Resource(workloadGVR(req.Kind)).Namespace(req.Namespace)
+	if req.Kind == "Deployment" {
+		obj, err := ri.Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "paused"); paused {
+			return fmt.Errorf("deployment %s is paused, resume it first", req.Name)
+		}
+	}
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = ri.Patch(ctx, req.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: k.fieldManager})
+	return err
+}
+
+// RolloutPause pauses or resumes the rollouts of a deployment.
+func (k *KubeAPI) RolloutPause(ctx context.Context, req model.RolloutRequest, paused bool) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if req.Kind != "Deployment" {
+		return errNotDeployment
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return err
+	}
+	patch := fmt.Appendf(nil, `{"spec":{"paused":%t}}`, paused)
+	_, err = server.Dynamic.Resource(workloadGVR(req.Kind)).
+		Namespace(req.Namespace).
+		Patch(ctx, req.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: k.fieldManager})
+	return err
+}
+
+// RolloutHistory lists the revisions of the workload, the ReplicaSets of a
+// deployment or the ControllerRevisions of a StatefulSet or a DaemonSet,
+// oldest first.
+func (k *KubeAPI) RolloutHistory(ctx context.Context, req model.RolloutRequest) ([]model.RolloutRevision, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []model.RolloutRevision
+	if req.Kind == "Deployment" {
+		revisions, err = deploymentRevisions(ctx, server, req)
+	} else {
+		revisions, err = controllerRevisions(ctx, server, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(revisions, func(a, b model.RolloutRevision) int {
+		return cmp.Compare(a.Revision, b.Revision)
+	})
+	previous := ""
+	for i := range revisions {
+		b, err := yaml.Marshal(revisions[i].Template)
+		if err != nil {
+			return nil, err
+		}
+		revisions[i].Diff, err = UnifiedDiff(previous, string(b), "previous", strconv.FormatInt(revisions[i].Revision, 10))
+		if err != nil {
+			return nil, err
+		}
+		previous = string(b)
+	}
+	if len(revisions) > 0 {
+		revisions[len(revisions)-1].Current = true
+	}
+	return revisions, nil
+}
+
+// RolloutUndo rolls the workload back to the revision, the previous one when
+// it's 0, and returns the kubectl message.
+func (k *KubeAPI) RolloutUndo(ctx context.Context, req model.RolloutRequest) (string, error) {
+	if err := req.Validate(); err != nil {
+		return "", err
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return "", err
+	}
+	var obj runtime.Object
+	apps := server.Typed.AppsV1()
+	switch req.Kind {
+	case "Deployment":
+		obj, err = apps.Deployments(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	case "StatefulSet":
+		obj, err = apps.StatefulSets(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	default:
+		obj, err = apps.DaemonSets(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return "", err
+	}
+	rollbacker, err := polymorphichelpers.RollbackerFor(schema.GroupKind{Group: appsv1.GroupName, Kind: req.Kind}, server.Typed)
+	if err != nil {
+		return "", err
+	}
+	return rollbacker.Rollback(obj, nil, req.Revision, cmdutil.DryRunNone)
+}
+
+// RolloutStatus watches the workload and publishes every change of the
+// rollout status until it's done or ctx is done.
+func (k *KubeAPI) RolloutStatus(ctx context.Context, req model.RolloutRequest, publish func(model.RolloutStatus)) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return err
+	}
+	viewer, err := polymorphichelpers.StatusViewerFor(schema.GroupKind{Group: appsv1.GroupName, Kind: req.Kind})
+	if err != nil {
+		return err
+	}
+	ri := server.Dynamic.Resource(workloadGVR(req.Kind)).Namespace(req.Namespace)
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", req.Name).String()
+	lw := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return ri.List(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return ri.Watch(ctx, options)
+		},
+	}
+	last := ""
+	_, err = watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, nil, func(e watch.Event) (bool, error) {
+		switch e.Type {
+		case watch.Deleted:
+			return false, fmt.Errorf("%s %s was deleted", req.Kind, req.Name)
+		case watch.Added, watch.Modified:
+			obj, ok := e.Object.(*unstructured.Unstructured)
+			if !ok {
+				return false, nil
+			}
+			message, done, err := viewer.Status(obj, 0)
+			if err != nil {
+				return false, err
+			}
+			if message != last || done {
+				last = message
+				publish(model.RolloutStatus{Message: message, Done: done})
+			}
+			return done, nil
+		}
+		return false, nil
+	})
+	return err
+}
+
+// CurrentRolloutStatus reads the rollout status once.
+func (k *KubeAPI) CurrentRolloutStatus(ctx context.Context, req model.RolloutRequest) (model.RolloutStatus, error) {
+	if err := req.Validate(); err != nil {
+		return model.RolloutStatus{}, err
+	}
+	ctx, cancel := k.WithTimeout(ctx, req.Server)
+	defer cancel()
+	server, err := k.clientFor(ctx, req.Server)
+	if err != nil {
+		return model.RolloutStatus{}, err
+	}
+	viewer, err := polymorphichelpers.StatusViewerFor(schema.GroupKind{Group: appsv1.GroupName, Kind: req.Kind})
+	if err != nil {
+		return model.RolloutStatus{}, err
+	}
+	obj, err := server.Dynamic.Resource(workloadGVR(req.Kind)).Namespace(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	if err != nil {
+		return model.RolloutStatus{}, err
+	}
+	message, done, err := viewer.Status(obj, 0)
+	if err != nil {
+		return model.RolloutStatus{}, err
+	}
+	return model.RolloutStatus{Message: message, Done: done}, nil
+}
+
+func workloadGVR(kind string) schema.GroupVersionResource {
+	resource := map[string]string{
+		"Deployment":  "deployments",
+		"StatefulSet": "statefulsets",
+		"DaemonSet":   "daemonsets",
+	}[kind]
+	return appsv1.SchemeGroupVersion.WithResource(resource)
+}
+
+func deploymentRevisions(ctx context.Context, server *config.Cluster, req model.RolloutRequest) ([]model.RolloutRevision, error) {
+	apps := server.Typed.AppsV1()
+	d, err := apps.Deployments(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := apps.ReplicaSets(req.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	revisions := []model.RolloutRevision{}
+	for i := range list.Items {
+		rs := &list.Items[i]
+		if !metav1.IsControlledBy(rs, d) {
+			continue
+		}
+		revision, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		// the hash differs in every revision, it's noise in the diff
+		template := rs.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(template)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, model.RolloutRevision{
+			Revision:    revision,
+			Name:        rs.Name,
+			ChangeCause: rs.Annotations[changeCauseAnnotation],
+			Created:     rs.CreationTimestamp.Time,
+			Template:    m,
+		})
+	}
+	return revisions, nil
+}
+
+// controllerRevisions reads the pod templates stored in the revisions, they
+// hold a patch of the workload with the whole template.
+func controllerRevisions(ctx context.Context, server *config.Cluster, req model.RolloutRequest) ([]model.RolloutRevision, error) {
+	apps := server.Typed.AppsV1()
+	var (
+		owner    metav1.Object
+		selector *metav1.LabelSelector
+	)
+	if req.Kind == "StatefulSet" {
+		sts, err := apps.StatefulSets(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		owner, selector = sts, sts.Spec.Selector
+	} else {
+		ds, err := apps.DaemonSets(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		owner, selector = ds, ds.Spec.Selector
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := apps.ControllerRevisions(req.Namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil, err
+	}
+	revisions := []model.RolloutRevision{}
+	for i := range list.Items {
+		cr := &list.Items[i]
+		if !metav1.IsControlledBy(cr, owner) {
+			continue
+		}
+		var data struct {
+			Spec struct {
+				Template map[string]any `json:"template"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(cr.Data.Raw, &data); err != nil {
+			return nil, err
+		}
+		delete(data.Spec.Template, "$patch")
+		revisions = append(revisions, model.RolloutRevision{
+			Revision:    cr.Revision,
+			Name:        cr.Name,
+			ChangeCause: cr.Annotations[changeCauseAnnotation],
+			Created:     cr.CreationTimestamp.Time,
+			Template:    data.Spec.Template,
+		})
+	}
+	return revisions, nil
+}
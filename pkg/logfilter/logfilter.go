@@ -0,0 +1,279 @@
+// Package logfilter selects log lines on the server, the browser only gets
+// the lines it asked for.
+package logfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"teleskopio/pkg/model"
+)
+
+// levels in the order of severity, the index is the rank
+var levels = []string{model.LogTrace, model.LogDebug, model.LogInfo, model.LogWarn, model.LogError, model.LogFatal}
+
+var aliases = map[string]string{
+	"trace":     model.LogTrace,
+	"debug":     model.LogDebug,
+	"dbg":       model.LogDebug,
+	"info":      model.LogInfo,
+	"inf":       model.LogInfo,
+	"notice":    model.LogInfo,
+	"warn":      model.LogWarn,
+	"warning":   model.LogWarn,
+	"wrn":       model.LogWarn,
+	"error":     model.LogError,
+	"err":       model.LogError,
+	"eror":      model.LogError,
+	"crit":      model.LogFatal,
+	"critical":  model.LogFatal,
+	"alert":     model.LogFatal,
+	"emerg":     model.LogFatal,
+	"fatal":     model.LogFatal,
+	"panic":     model.LogFatal,
+	"dpanic":    model.LogFatal,
+	"emergency": model.LogFatal,
+}
+
+// jsonLevelKeys are the usual keys of the level in structured logs.
+var jsonLevelKeys = []string{"level", "lvl", "severity", "loglevel", "log.level", "levelname"}
+
+var (
+	logfmtPair   = regexp.MustCompile(`([\w.\-]+)=("(?:[^"\\]|\\.)*"|\S*)`)
+	logfmtLevel  = regexp.MustCompile(`(?i)\b(?:level|lvl|severity)=["']?(\w+)`)
+	klogHeader   = regexp.MustCompile(`^([IWEF])\d{4} `)
+	levelKeyword = regexp.MustCompile(`(?i)\b(trace|debug|info|notice|warn(?:ing)?|error|crit(?:ical)?|fatal|panic)\b`)
+)
+
+// Filter matches the lines of a model.LogFilter, the zero filter matches
+// every line.
+type Filter struct {
+	include    *regexp.Regexp
+	exclude    *regexp.Regexp
+	level      int
+	fields     map[string]string
+	context    int
+	timestamps bool
+}
+
+// New compiles the filter, timestamps tells the lines start with the
+// timestamp added by the api server, it's skipped by the matchers.
+func New(f model.LogFilter, timestamps bool) (*Filter, error) {
+	filter := &Filter{
+		level:      -1,
+		fields:     f.Fields,
+		context:    f.Context,
+		timestamps: timestamps,
+	}
+	var err error
+	if f.Include != "" {
+		if filter.include, err = regexp.Compile(f.Include); err != nil {
+			return nil, fmt.Errorf("include: %w", err)
+		}
+	}
+	if f.Exclude != "" {
+		if filter.exclude, err = regexp.Compile(f.Exclude); err != nil {
+			return nil, fmt.Errorf("exclude: %w", err)
+		}
+	}
+	if f.Level != "" {
+		filter.level = slices.Index(levels, f.Level)
+		if filter.level < 0 {
+			return nil, fmt.Errorf("unknown level %s", f.Level)
+		}
+	}
+	return filter, nil
+}
+
+// Match reports whether the line is selected and the detected level of it.
+func (f *Filter) Match(line string) (bool, string) {
+	return f.match(line, false)
+}
+
+// match checks the line, continued tells the previous line matched. An
+// unleveled line following a match, like a stack trace, passes the level
+// filter, it belongs to the leveled line.
+func (f *Filter) match(line string, continued bool) (bool, string) {
+	text := line
+	if f.timestamps {
+		if _, rest, found := strings.Cut(line, " "); found {
+			text = rest
+		}
+	}
+	var fields map[string]any
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		// not every line starting with a brace is JSON, those are plain text
+		if json.Unmarshal([]byte(text), &fields) != nil {
+			fields = nil
+		}
+	}
+	level := Level(text, fields)
+	if f.include != nil && !f.include.MatchString(text) {
+		return false, level
+	}
+	if f.exclude != nil && f.exclude.MatchString(text) {
+		return false, level
+	}
+	if f.level >= 0 && !(continued && level == "") && slices.Index(levels, level) < f.level {
+		return false, level
+	}
+	for key, want := range f.fields {
+		got, found := field(text, fields, key)
+		if !found || !strings.EqualFold(got, want) {
+			return false, level
+		}
+	}
+	return true, level
+}
+
+// Level detects the level of the line, from the JSON fields when it's a
+// structured one, then from logfmt, the klog header and the first level
+// keyword. It's empty when nothing looks like a level.
+func Level(line string, fields map[string]any) string {
+	if fields != nil {
+		for _, key := range jsonLevelKeys {
+			v, found := lookup(fields, key)
+			if !found {
+				continue
+			}
+			switch v := v.(type) {
+			case string:
+				if level, ok := aliases[strings.ToLower(v)]; ok {
+					return level
+				}
+			case float64:
+				// pino and bunyan levels
+				switch {
+				case v >= 60:
+					return model.LogFatal
+				case v >= 50:
+					return model.LogError
+				case v >= 40:
+					return model.LogWarn
+				case v >= 30:
+					return model.LogInfo
+				case v >= 20:
+					return model.LogDebug
+				default:
+					return model.LogTrace
+				}
+			}
+		}
+	}
+	if m := logfmtLevel.FindStringSubmatch(line); m != nil {
+		if level, ok := aliases[strings.ToLower(m[1])]; ok {
+			return level
+		}
+	}
+	if m := klogHeader.FindStringSubmatch(line); m != nil {
+		return map[string]string{"I": model.LogInfo, "W": model.LogWarn, "E": model.LogError, "F": model.LogFatal}[m[1]]
+	}
+	if m := levelKeyword.FindStringSubmatch(line); m != nil {
+		return aliases[strings.ToLower(m[1])]
+	}
+	return ""
+}
+
+// field returns the value of the key in the JSON fields or in the logfmt
+// pairs of the line.
+func field(line string, fields map[string]any, key string) (string, bool) {
+	if fields != nil {
+		v, found := lookup(fields, key)
+		if !found {
+			return "", false
+		}
+		if s, ok := v.(string); ok {
+			return s, true
+		}
+		b, err := json.Marshal(v)
+		return string(b), err == nil
+	}
+	for _, m := range logfmtPair.FindAllStringSubmatch(line, -1) {
+		if m[1] == key {
+			return strings.Trim(m[2], `"`), true
+		}
+	}
+	return "", false
+}
+
+// lookup reads the key, a flat key with dots wins over the nested one.
+func lookup(fields map[string]any, key string) (any, bool) {
+	if v, found := fields[key]; found {
+		return v, true
+	}
+	head, rest, nested := strings.Cut(key, ".")
+	if !nested {
+		return nil, false
+	}
+	m, ok := fields[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookup(m, rest)
+}
+
+// Line is a selected line, Context marks the lines kept around a match and
+// Gap the first line after dropped ones.
+type Line struct {
+	Text    string
+	Level   string
+	Context bool
+	Gap     bool
+}
+
+// Grep selects the lines of one stream with their context like grep -C, a
+// stream needs its own.
+type Grep struct {
+	filter *Filter
+	before []Line
+	// after - the context lines still due after the last match
+	after   int
+	dropped bool
+	emitted bool
+	// matched - the previous line matched
+	matched bool
+}
+
+func (f *Filter) Grep() *Grep {
+	return &Grep{filter: f}
+}
+
+// Push reads the next line and emits the ones it selects, a match emits
+// the context kept before it.
+func (g *Grep) Push(text string, emit func(Line)) {
+	match, level := g.filter.match(text, g.matched)
+	g.matched = match
+	line := Line{Text: text, Level: level}
+	switch {
+	case match:
+		for _, l := range g.before {
+			g.emit(l, emit)
+		}
+		g.before = g.before[:0]
+		g.emit(line, emit)
+		g.after = g.filter.context
+	case g.after > 0:
+		g.after--
+		line.Context = true
+		g.emit(line, emit)
+	case g.filter.context > 0:
+		line.Context = true
+		if len(g.before) == g.filter.context {
+			g.before = slices.Delete(g.before, 0, 1)
+			g.dropped = true
+		}
+		g.before = append(g.before, line)
+	default:
+		g.dropped = true
+	}
+}
+
+func (g *Grep) emit(line Line, emit func(Line)) {
+	line.Gap = g.dropped && g.emitted
+	g.dropped = false
+	g.emitted = true
+	emit(line)
+}
@@ -0,0 +1,108 @@
+package logfilter
+
+import (
+	"strings"
+	"testing"
+
+	"teleskopio/pkg/model"
+)
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		line  string
+		level string
+	}{
+		{`{"level":"error","msg":"boom"}`, model.LogError},
+		{`{"severity":"WARNING","msg":"slow"}`, model.LogWarn},
+		{`{"log":{"level":"debug"}}`, model.LogDebug},
+		{`{"level":50,"msg":"pino"}`, model.LogError},
+		{`time=2024-01-02T03:04:05Z level=info msg="started"`, model.LogInfo},
+		{`E1018 10:00:00.000000       1 controller.go:42] sync failed`, model.LogError},
+		{`2024-01-02 03:04:05 [WARN] disk almost full`, model.LogWarn},
+		{`GET /healthz 200`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			f, _ := New(model.LogFilter{}, false)
+			if _, level := f.Match(tt.line); level != tt.level {
+				t.Fatalf("expected %q, got %q", tt.level, level)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter model.LogFilter
+		line   string
+		match  bool
+	}{
+		{"include", model.LogFilter{Include: `time(out)?`}, "request timeout", true},
+		{"include misses", model.LogFilter{Include: `timeout`}, "request done", false},
+		{"exclude", model.LogFilter{Exclude: `healthz`}, "GET /healthz", false},
+		{"level above", model.LogFilter{Level: model.LogWarn}, `level=error msg=x`, true},
+		{"level below", model.LogFilter{Level: model.LogWarn}, `level=info msg=x`, false},
+		{"json field", model.LogFilter{Fields: map[string]string{"level": "error"}}, `{"level":"ERROR"}`, true},
+		{"nested json field", model.LogFilter{Fields: map[string]string{"req.status": "500"}}, `{"req":{"status":500}}`, true},
+		{"logfmt field", model.LogFilter{Fields: map[string]string{"user": "bob smith"}}, `msg=login user="bob smith"`, true},
+		{"missing field", model.LogFilter{Fields: map[string]string{"user": "bob"}}, `msg=login`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New(tt.filter, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if match, _ := f.Match(tt.line); match != tt.match {
+				t.Fatalf("expected %v", tt.match)
+			}
+		})
+	}
+
+	f, _ := New(model.LogFilter{Include: `^boom`}, true)
+	if match, _ := f.Match("2024-01-02T03:04:05.000000000Z boom"); !match {
+		t.Fatal("the timestamp must be skipped")
+	}
+}
+
+func TestGrepContext(t *testing.T) {
+	f, err := New(model.LogFilter{Include: "match", Context: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := f.Grep()
+	var got []string
+	for _, text := range []string{"a", "b", "match 1", "c", "d", "e", "match 2", "f"} {
+		g.Push(text, func(l Line) {
+			s := l.Text
+			if l.Context {
+				s = "~" + s
+			}
+			if l.Gap {
+				s = "--" + s
+			}
+			got = append(got, s)
+		})
+	}
+	want := "~b,match 1,~c,--~e,match 2,~f"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestGrepContinuation(t *testing.T) {
+	f, err := New(model.LogFilter{Level: model.LogError}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := f.Grep()
+	var got []string
+	for _, text := range []string{"INFO start", "ERROR boom", "  at foo()", "  at bar()", "INFO next", "  at baz()"} {
+		g.Push(text, func(l Line) { got = append(got, l.Text) })
+	}
+	want := "ERROR boom,  at foo(),  at bar()"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(got, ","))
+	}
+}
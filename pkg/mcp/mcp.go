@@ -7,6 +7,7 @@ import (
 
 	"teleskopio/pkg/config"
 	"teleskopio/pkg/kubeapi"
+	"teleskopio/pkg/rbac"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -16,15 +17,14 @@ import (
 type Server struct {
 	server *server.MCPServer
 	kapi   *kubeapi.KubeAPI
-	cfg    config.Config
+	rbac   *rbac.Authorizer
+	cfg    *config.Current
 }
 
-const requestTimeout = time.Second * 5
-
-func New(cfg config.Config, kapi *kubeapi.KubeAPI) *Server {
+func New(cfg *config.Current, kapi *kubeapi.KubeAPI) *Server {
 	mcpServer := server.NewMCPServer(
 		"teleskopio",
-		cfg.Version,
+		cfg.Get().Version,
 		server.WithToolCapabilities(true), // Enable tool capabilities
 		server.WithIcons(
 			mcp.Icon{
@@ -40,6 +40,7 @@ func New(cfg config.Config, kapi *kubeapi.KubeAPI) *Server {
 	return &Server{
 		cfg:    cfg,
 		kapi:   kapi,
+		rbac:   rbac.New(cfg, kapi.Address),
 		server: mcpServer,
 	}
 }
@@ -56,7 +57,7 @@ func (s *Server) ServeHTTP() *server.StreamableHTTPServer {
 		server.WithHeartbeatInterval(30*time.Second), // TODO custom
 		server.WithEndpointPath("/mcp"),
 		server.WithStreamableHTTPCORS(
-			server.WithCORSAllowedOrigins(s.cfg.MCP.Cors.Origin),
+			server.WithCORSAllowedOrigins(s.cfg.Get().MCP.Cors.Origin),
 			server.WithCORSAllowCredentials(),
 		),
 	)
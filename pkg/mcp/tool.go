@@ -7,6 +7,7 @@ import (
 	"slices"
 
 	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/tidwall/gjson"
@@ -17,13 +18,13 @@ import (
 func LoadTools(mcpServer *Server) *Server {
 	mcpServer.server.AddTool(
 		mcp.NewTool("clusters",
-			mcp.WithDescription("Get available kubernetes cluster endpoints"),
+			mcp.WithDescription("Get available kubernetes clusters, the name is used as the server of the other tools, addresses and labels are included"),
 		),
 		mcpServer.clusters,
 	) // clusters
 	mcpServer.server.AddTool(
 		mcp.NewTool("api_resources",
-			mcp.WithDescription("Get available api resources of the kubernetes cluster, filter by kind is available."),
+			mcp.WithDescription("Get available api resources of the kubernetes cluster, filter by kind or category is available."),
 			mcp.WithInputSchema[model.APIResourceRequest](),
 			mcp.WithOutputSchema[model.APIResourceResponse](),
 		),
@@ -32,7 +33,7 @@ func LoadTools(mcpServer *Server) *Server {
 	//nolint:lll
 	mcpServer.server.AddTool(
 		mcp.NewTool("list_resources",
-			mcp.WithDescription("Get the list of resources by field selector or label selector. Available resource is requested by api_resources tool. An example of resource key to list nodes: {'apiVersion':'v1','group':'','version':'v1','kind':'Node','namespaced':false,'resource':'nodes'}"),
+			mcp.WithDescription("Get the list of resources by field selector or label selector. Available resource is requested by api_resources tool. An example of resource key to list nodes: {'apiVersion':'v1','group':'','version':'v1','kind':'Node','namespaced':false,'resource':'nodes'}, the kind or the resource name like deploy is enough to find the rest"),
 			mcp.WithInputSchema[model.ResourceFilter](),
 			mcp.WithOutputSchema[model.ResourceFilterResponse](),
 		),
@@ -44,7 +45,10 @@ func LoadTools(mcpServer *Server) *Server {
 
 func (s *Server) clusters(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	slog.Debug("new tool call", "tool", "clusters")
-	resp, err := mcp.NewToolResultJSON(map[string]any{"clusters": s.kapi.GetClusters()})
+	clusters := slices.DeleteFunc(s.kapi.GetClusters(), func(c model.Cluster) bool {
+		return !s.rbac.AllowedCluster(s.cfg.Get().MCP.Role, c.Server)
+	})
+	resp, err := mcp.NewToolResultJSON(map[string]any{"clusters": clusters})
 	return resp, err
 }
 
@@ -54,6 +58,14 @@ func (s *Server) apiResources(_ context.Context, _ mcp.CallToolRequest, args mod
 	if err := args.Validate(); err != nil {
 		return ar, err
 	}
+	if !s.rbac.AllowedCluster(s.cfg.Get().MCP.Role, args.Server) {
+		return ar, rbac.ErrForbidden
+	}
+	if args.Category != "" {
+		apiResources, err := s.kapi.ExpandCategory(args.Server, args.Category)
+		ar.Items = apiResources
+		return ar, err
+	}
 	apiResources, err := s.kapi.ListResources(args.Server)
 	if err != nil {
 		return ar, err
@@ -73,15 +85,20 @@ func (s *Server) listResources(ctx context.Context, _ mcp.CallToolRequest, args
 	if err := args.Validate(); err != nil {
 		return resources, err
 	}
-	kapi, err := s.kapi.GetClient(args.Server)
-	if err != nil {
+	if err := s.kapi.ResolveResource(args.Server, &args.Resource); err != nil {
 		return resources, err
 	}
-	apiResourceList, err := s.kapi.GetResource(args.Server, args.Resource)
+	namespace := args.Namespace
+	if !args.Resource.Namespaced {
+		namespace = ""
+	}
+	if !s.rbac.Allowed(rbac.Request{Role: s.cfg.Get().MCP.Role, Cluster: args.Server, Namespace: namespace, Kind: args.Resource.Kind, Verb: rbac.List}) {
+		return resources, rbac.ErrForbidden
+	}
+	kapi, err := s.kapi.GetClient(ctx, args.Server)
 	if err != nil {
 		return resources, err
 	}
-	s.kapi.SetResource(&args.Resource, apiResourceList)
 	gvr := args.Resource.GetGVR()
 
 	var ri dynamic.ResourceInterface
@@ -91,7 +108,7 @@ func (s *Server) listResources(ctx context.Context, _ mcp.CallToolRequest, args
 		ri = kapi.Dynamic.Resource(gvr)
 	}
 
-	ctxtimeout, cancel := context.WithTimeout(ctx, requestTimeout)
+	ctxtimeout, cancel := s.kapi.WithTimeout(ctx, args.Server)
 	defer cancel()
 	opts := metav1.ListOptions{
 		FieldSelector: args.FieldSelector,
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"teleskopio/pkg/config"
@@ -14,13 +15,13 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-const viewerRole = "viewer"
-
+// Middleware reads the current config on every request, so a reload applies
+// to the next requests.
 type Middleware struct {
-	cfg *config.Config
+	cfg *config.Current
 }
 
-func New(cfg *config.Config) Middleware {
+func New(cfg *config.Current) Middleware {
 	return Middleware{cfg}
 }
 
@@ -28,75 +29,100 @@ func (m Middleware) Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		t := time.Now()
 		c.Next()
-		if c.Request.RequestURI == "/api/ping" || c.Request.RequestURI == "/api/lookup_configs" {
+		if c.Request.URL.Path == "/api/ping" || c.Request.URL.Path == "/api/lookup_configs" {
 			return
 		}
 		latency := time.Since(t)
 		status := c.Writer.Status()
-		slog.Default().Debug("incoming request", "route", c.Request.RequestURI, "method", c.Request.Method, "status", status, "latency", latency)
+		// the websocket routes carry the JWT in the query, it's left out
+		slog.Default().Debug("incoming request", "route", c.Request.URL.Path, "method", c.Request.Method, "status", status, "latency", latency)
 	}
 }
 
-func (m Middleware) CheckRole() gin.HandlerFunc {
+func (m Middleware) MCPProtect() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if m.cfg.AuthDisabled {
-			c.Next()
-			return
-		}
-		userRole := c.GetString("role")
-		if userRole == viewerRole || userRole == "" {
+		cfg := m.cfg.Get()
+		tokenStr := c.GetHeader(cfg.MCP.APIKeyHeader)
+		if tokenStr == "" || tokenStr != cfg.MCP.APIKey {
 			c.Abort()
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "read only access"})
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
 			return
 		}
 		c.Next()
 	}
 }
 
-func (m Middleware) MCPProtect() gin.HandlerFunc {
+func (m Middleware) Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenStr := c.GetHeader(m.cfg.MCP.APIKeyHeader)
-		if tokenStr == "" || tokenStr != m.cfg.MCP.APIKey {
-			c.Abort()
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
-			return
-		}
-		c.Next()
+		m.authorize(c, c.GetHeader("Token"))
 	}
 }
 
-func (m Middleware) Auth() gin.HandlerFunc {
+// WebsocketAuth - browsers cant set headers on the websocket upgrade request,
+// so the token is passed with the token query param.
+func (m Middleware) WebsocketAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if m.cfg.AuthDisabled {
-			c.Next()
-			return
-		}
-		tokenStr := c.GetHeader("Token")
+		tokenStr := c.Query("token")
 		if tokenStr == "" {
-			c.Abort()
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
-			return
-		}
-		claim := &model.Claims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claim, func(_ *jwt.Token) (interface{}, error) {
-			return []byte(m.cfg.JWTKey), nil
-		})
-		if err != nil || !token.Valid {
-			c.Abort()
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
-			return
+			tokenStr = c.GetHeader("Token")
 		}
-		c.Set("role", claim.Role)
+		m.authorize(c, tokenStr)
+	}
+}
+
+func (m Middleware) authorize(c *gin.Context, tokenStr string) {
+	cfg := m.cfg.Get()
+	if cfg.AuthDisabled {
 		c.Next()
+		return
 	}
+	if tokenStr == "" {
+		c.Abort()
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
+		return
+	}
+	claim := &model.Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claim, func(_ *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWTKey), nil
+	})
+	if err != nil || !token.Valid {
+		c.Abort()
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
+		return
+	}
+	c.Set("role", claim.Role)
+	c.Set("username", claim.Username)
+	c.Set("claims", claim)
+	c.Request = c.Request.WithContext(model.WithClaims(c.Request.Context(), claim))
+	c.Next()
 }
 
+// CORS follows the current config, the handler is built again once the
+// config is reloaded.
 func (m Middleware) CORS() gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		built   *config.Config
+		handler gin.HandlerFunc
+	)
+	return func(c *gin.Context) {
+		cfg := m.cfg.Get()
+		mu.Lock()
+		if cfg != built {
+			built, handler = cfg, corsHandler(cfg)
+		}
+		h := handler
+		mu.Unlock()
+		h(c)
+	}
+}
+
+func corsHandler(cfg *config.Config) gin.HandlerFunc {
 	allowedHeaders := []string{"Token", "Content-Type", "Content-Length", "Accept-Encoding", "Accept", "Origin", "Cache-Control"}
-	origins := []string{(&url.URL{Scheme: m.cfg.Protocol, Host: m.cfg.ServerHTTP}).String()}
-	if m.cfg.MCP.Enabled {
-		allowedHeaders = append(allowedHeaders, m.cfg.MCP.Cors.Headers...)
-		origins = append(origins, m.cfg.MCP.Cors.Origin)
+	origins := []string{(&url.URL{Scheme: cfg.Protocol, Host: cfg.ServerHTTP}).String()}
+	if cfg.MCP.Enabled {
+		allowedHeaders = append(allowedHeaders, cfg.MCP.Cors.Headers...)
+		origins = append(origins, cfg.MCP.Cors.Origin)
 	}
 	slog.Debug("cors", "origins", origins, "headers", allowedHeaders)
 	return cors.New(cors.Config{
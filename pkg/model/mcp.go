@@ -11,8 +11,9 @@ type PayloadRequest struct {
 
 //nolint:staticcheck
 type APIResourceRequest struct {
-	Server string `json:"server,required" jsonschema_description:"the kubernetes cluster endpoint"`
-	Kind   string `json:"kind" jsonschema_description:"filter data by the kind of resource e.g. Pod, Event, Node. if kind is empty all resources will be returned"`
+	Server   string `json:"server,required" jsonschema_description:"the kubernetes cluster endpoint"`
+	Kind     string `json:"kind" jsonschema_description:"filter data by the kind of resource e.g. Pod, Event, Node. if kind is empty all resources will be returned"`
+	Category string `json:"category" jsonschema_description:"the resources of the category e.g. all, the kind filter is ignored then"`
 }
 
 func (p *APIResourceRequest) Validate() error {
@@ -2,19 +2,73 @@
 package model
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/golang-jwt/jwt/v5"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Groups   []string `json:"groups,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Subscription - the websocket clients subscribe to the topic with the token,
+// it's signed for the user by the endpoint handing out the topic.
+type Subscription struct {
+	Topic string `json:"topic"`
+	Token string `json:"token"`
+}
+
+type claimsKey struct{}
+
+// WithClaims stores the claims of the authenticated user in the request context.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Cluster - Server is the name the requests refer to the cluster by, it's
+// the same as Name.
 type Cluster struct {
-	Server string `json:"server"`
+	Server  string            `json:"server"`
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// AddClusterRequest - Kubeconfig is the uploaded kubeconfig, the current
+// context is used when Context is empty.
+type AddClusterRequest struct {
+	Kubeconfig string            `json:"kubeconfig"`
+	Context    string            `json:"context"`
+	Alias      string            `json:"alias"`
+	Labels     map[string]string `json:"labels"`
+	Persist    bool              `json:"persist"`
+}
+
+func (a *AddClusterRequest) Validate() error {
+	return validation.ValidateStruct(a,
+		validation.Field(&a.Kubeconfig, validation.Required),
+	)
+}
+
+type ClusterStatus struct {
+	Server  string `json:"server"`
+	Version string `json:"version"`
+	Groups  int    `json:"groups"`
 }
 
 type Creds struct {
@@ -107,12 +161,22 @@ func (g *GetRequest) Validate() error {
 	return nil
 }
 
+// PodLogRequest - Previous reads the logs of the terminated instance of the
+// container, SinceSeconds and SinceTime are exclusive. The form tags serve
+// the download, Gzip only applies there.
 type PodLogRequest struct {
-	Server    string `json:"server"`
-	Name      string `json:"name"`
-	Namespace string `json:"namespace"`
-	Container string `json:"container"`
-	TailLines *int64 `json:"tail_lines"`
+	Server       string     `json:"server" form:"server"`
+	Name         string     `json:"name" form:"name"`
+	Namespace    string     `json:"namespace" form:"namespace"`
+	Container    string     `json:"container" form:"container"`
+	TailLines    *int64     `json:"tail_lines" form:"tail_lines"`
+	Previous     bool       `json:"previous" form:"previous"`
+	Timestamps   bool       `json:"timestamps" form:"timestamps"`
+	SinceSeconds *int64     `json:"since_seconds" form:"since_seconds"`
+	SinceTime    *time.Time `json:"since_time" form:"since_time"`
+	LimitBytes   *int64     `json:"limit_bytes" form:"limit_bytes"`
+	Gzip         bool       `json:"gzip" form:"gzip"`
+	Filter       *LogFilter `json:"filter" form:"-"`
 }
 
 func (p *PodLogRequest) Validate() error {
@@ -121,9 +185,257 @@ func (p *PodLogRequest) Validate() error {
 		validation.Field(&p.Name, validation.Required),
 		validation.Field(&p.Namespace, validation.Required),
 		validation.Field(&p.Container, validation.Required),
+		validation.Field(&p.TailLines, validation.Min(int64(0))),
+		validation.Field(&p.SinceSeconds, validation.Min(int64(1))),
+		validation.Field(&p.SinceTime, validation.When(p.SinceSeconds != nil, validation.Nil.Error("since_seconds and since_time are exclusive"))),
+		validation.Field(&p.LimitBytes, validation.Min(int64(1))),
+		validation.Field(&p.Filter),
+	)
+}
+
+// ExecRequest is read from the query of the exec websocket, Command
+// defaults to a shell and Container to the default one of the pod.
+type ExecRequest struct {
+	Server    string   `form:"server"`
+	Name      string   `form:"name"`
+	Namespace string   `form:"namespace"`
+	Container string   `form:"container"`
+	Command   []string `form:"command"`
+	TTY       bool     `form:"tty"`
+}
+
+func (e *ExecRequest) Validate() error {
+	return validation.ValidateStruct(e,
+		validation.Field(&e.Server, validation.Required),
+		validation.Field(&e.Name, validation.Required),
+		validation.Field(&e.Namespace, validation.Required),
+	)
+}
+
+// Types of ExecMessage, the client sends stdin and resize, the server sends
+// stdout, stderr and exit as the last one.
+const (
+	ExecStdin  = "stdin"
+	ExecResize = "resize"
+	ExecStdout = "stdout"
+	ExecStderr = "stderr"
+	ExecExit   = "exit"
+)
+
+// ExecMessage is a frame of the exec websocket, Data is base64 encoded in
+// JSON, Error is set by a failed exit.
+type ExecMessage struct {
+	Type  string `json:"type"`
+	Data  []byte `json:"data,omitempty"`
+	Cols  uint16 `json:"cols,omitempty"`
+	Rows  uint16 `json:"rows,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PortForwardRequest - Kind is Pod or Service, a service is resolved to one
+// of its ready pods and Port is the service port. LocalPort 0 picks a free
+// one. Tunnel forwards are only reachable through the websocket.
+type PortForwardRequest struct {
+	Server    string `json:"server"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Port      int    `json:"port"`
+	LocalPort int    `json:"local_port"`
+	Tunnel    bool   `json:"tunnel"`
+}
+
+func (p *PortForwardRequest) Validate() error {
+	return validation.ValidateStruct(p,
+		validation.Field(&p.Server, validation.Required),
+		validation.Field(&p.Namespace, validation.Required),
+		validation.Field(&p.Kind, validation.Required, validation.In("Pod", "Service")),
+		validation.Field(&p.Name, validation.Required),
+		validation.Field(&p.Port, validation.Required, validation.Min(1), validation.Max(65535)),
+		validation.Field(&p.LocalPort, validation.Min(0), validation.Max(65535)),
+	)
+}
+
+// PortForward is an active forward, Pod and PodPort are the resolved
+// target. It lives until it's stopped, the pod goes away or the session of
+// its user ends.
+type PortForward struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	Namespace string    `json:"namespace"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Port      int       `json:"port"`
+	Pod       string    `json:"pod"`
+	PodPort   int       `json:"pod_port"`
+	Address   string    `json:"address"`
+	LocalPort int       `json:"local_port"`
+	Tunnel    bool      `json:"tunnel"`
+	User      string    `json:"user"`
+	Started   time.Time `json:"started"`
+}
+
+type PortForwardID struct {
+	ID string `json:"id" form:"id"`
+}
+
+// RolloutRequest - Revision is the one to undo to, 0 is the previous one.
+type RolloutRequest struct {
+	Server    string `json:"server"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Revision  int64  `json:"revision"`
+}
+
+func (r *RolloutRequest) Validate() error {
+	return validation.ValidateStruct(r,
+		validation.Field(&r.Server, validation.Required),
+		validation.Field(&r.Namespace, validation.Required),
+		validation.Field(&r.Kind, validation.Required, validation.In("Deployment", "StatefulSet", "DaemonSet")),
+		validation.Field(&r.Name, validation.Required),
+		validation.Field(&r.Revision, validation.Min(0)),
+	)
+}
+
+// RolloutRevision - Diff is the unified diff of the pod template with the
+// previous revision, the current revision is the last one.
+type RolloutRevision struct {
+	Revision    int64          `json:"revision"`
+	Name        string         `json:"name"`
+	ChangeCause string         `json:"change_cause"`
+	Created     time.Time      `json:"created"`
+	Template    map[string]any `json:"template"`
+	Diff        string         `json:"diff"`
+	Current     bool           `json:"current"`
+}
+
+// RolloutStatus is published while the rollout progresses, Done ends it.
+type RolloutStatus struct {
+	Message string `json:"message"`
+	Done    bool   `json:"done"`
+	Error   string `json:"error,omitempty"`
+}
+
+// LogStreamRequest - the pods are selected by the label Selector or by the
+// workload Kind and Name. Container limits the stream to the containers of
+// that name, every running container is streamed otherwise. TailLines,
+// SinceSeconds and SinceTime only apply to the pods running when the stream
+// starts, the pods created later are streamed from their first line.
+type LogStreamRequest struct {
+	Server       string     `json:"server"`
+	Namespace    string     `json:"namespace"`
+	Kind         string     `json:"kind"`
+	Name         string     `json:"name"`
+	Selector     string     `json:"selector"`
+	Container    string     `json:"container"`
+	TailLines    *int64     `json:"tail_lines"`
+	Timestamps   bool       `json:"timestamps"`
+	SinceSeconds *int64     `json:"since_seconds"`
+	SinceTime    *time.Time `json:"since_time"`
+	Filter       *LogFilter `json:"filter"`
+}
+
+func (l *LogStreamRequest) Validate() error {
+	return validation.ValidateStruct(l,
+		validation.Field(&l.Server, validation.Required),
+		validation.Field(&l.Namespace, validation.Required),
+		validation.Field(&l.Kind, validation.In("Pod", "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job")),
+		validation.Field(&l.Name, validation.When(l.Kind != "", validation.Required)),
+		validation.Field(&l.Selector, validation.When(l.Kind == "", validation.Required)),
+		validation.Field(&l.TailLines, validation.Min(int64(0))),
+		validation.Field(&l.SinceSeconds, validation.Min(int64(1))),
+		validation.Field(&l.SinceTime, validation.When(l.SinceSeconds != nil, validation.Nil.Error("since_seconds and since_time are exclusive"))),
+		validation.Field(&l.Filter),
 	)
 }
 
+// Topic is the websocket topic the lines are published to.
+func (l *LogStreamRequest) Topic() string {
+	target := "selector_" + l.Selector
+	if l.Kind != "" {
+		target = l.Kind + "_" + l.Name
+	}
+	topic := fmt.Sprintf("logs_%s_%s_%s_%s", l.Server, l.Namespace, target, l.Container)
+	// the lines differ, it's another stream
+	if l.Timestamps {
+		topic += "_timestamps"
+	}
+	// the stream starts at another line, a user joining it would miss the
+	// lines it asked for
+	if l.TailLines != nil {
+		topic += fmt.Sprintf("_tail%d", *l.TailLines)
+	}
+	if l.SinceSeconds != nil {
+		topic += fmt.Sprintf("_since%ds", *l.SinceSeconds)
+	}
+	if l.SinceTime != nil {
+		topic += fmt.Sprintf("_since%d", l.SinceTime.Unix())
+	}
+	if l.Filter != nil {
+		b, _ := json.Marshal(l.Filter)
+		h := fnv.New32a()
+		h.Write(b)
+		topic += fmt.Sprintf("_%08x", h.Sum32())
+	}
+	return topic
+}
+
+// LogLine is a line of a container, tagged with its origin. The filtered
+// streams set Level, Context marks the lines around a match and Gap the
+// first line after dropped ones.
+type LogLine struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Line      string `json:"line"`
+	Level     string `json:"level,omitempty"`
+	Context   bool   `json:"context,omitempty"`
+	Gap       bool   `json:"gap,omitempty"`
+}
+
+// Log levels, lowest first.
+const (
+	LogTrace = "trace"
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+	LogFatal = "fatal"
+)
+
+// LogFilter selects the lines on the server side. Include and Exclude are
+// regular expressions, Level is the lowest detected level kept, the unleveled
+// lines following a kept one stay with it, and Fields
+// match the keys of JSON or logfmt lines, a dot reaches nested JSON keys.
+// Context keeps that many lines around every match.
+type LogFilter struct {
+	Include string            `json:"include"`
+	Exclude string            `json:"exclude"`
+	Level   string            `json:"level"`
+	Fields  map[string]string `json:"fields"`
+	Context int               `json:"context"`
+}
+
+func (l *LogFilter) Validate() error {
+	return validation.ValidateStruct(l,
+		validation.Field(&l.Include, validation.By(validRegexp)),
+		validation.Field(&l.Exclude, validation.By(validRegexp)),
+		validation.Field(&l.Level, validation.In(LogTrace, LogDebug, LogInfo, LogWarn, LogError, LogFatal)),
+		validation.Field(&l.Context, validation.Min(0), validation.Max(100)),
+	)
+}
+
+func validRegexp(value any) error {
+	_, err := regexp.Compile(value.(string))
+	return err
+}
+
+type LogTopic struct {
+	Topic string `json:"topic"`
+}
+
 type DeleteRequest struct {
 	Server    string `json:"server"`
 	Name      string `json:"name"`
@@ -141,11 +453,51 @@ func (d *DeleteRequest) Validate() error {
 	)
 }
 
+// ObjectRequest - Operation is create, update or apply, it's only read by
+// the diff. Force takes over the fields owned by other managers on apply.
+// Yaml may hold several documents, Namespace is the default namespace of
+// their namespaced objects. Atomic writes nothing unless every object passes
+// a dry run.
 type ObjectRequest struct {
 	Server    string `json:"server"`
 	Namespace string `json:"namespace"`
 
-	Yaml string `json:"yaml"`
+	Yaml         string `json:"yaml"`
+	Operation    string `json:"operation"`
+	DryRun       bool   `json:"dry_run"`
+	Force        bool   `json:"force"`
+	FieldManager string `json:"field_manager"`
+	Atomic       bool   `json:"atomic"`
+}
+
+// Statuses of ObjectResult, skipped objects were not written because an
+// other object of an atomic request failed.
+const (
+	ObjectApplied = "applied"
+	ObjectFailed  = "failed"
+	ObjectSkipped = "skipped"
+)
+
+// ObjectResult - the outcome of one object of a manifest, Object is the one
+// persisted by the api server.
+type ObjectResult struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Namespace  string         `json:"namespace"`
+	Name       string         `json:"name"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Object     map[string]any `json:"object,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// ObjectDiff - Live is empty when the object doesn't exist, Diff is the
+// unified diff of both as YAML.
+type ObjectDiff struct {
+	Live   map[string]any `json:"live"`
+	Merged map[string]any `json:"merged"`
+	Diff   string         `json:"diff"`
 }
 
 func (o *ObjectRequest) Validate() error {
@@ -188,6 +540,152 @@ type HelmChart struct {
 	Server     string   `json:"server,omitempty"`
 }
 
+// HelmReleaseRequest - Revision is the rollback target, 0 is the previous
+// one. Values is the YAML of the upgrade values, merged over the values of
+// the release with ReuseValues. Wait waits for the resources to be ready up
+// to Timeout seconds.
+type HelmReleaseRequest struct {
+	Server      string `json:"server"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Revision    int    `json:"revision"`
+	Values      string `json:"values"`
+	ReuseValues bool   `json:"reuse_values"`
+	KeepHistory bool   `json:"keep_history"`
+	Wait        bool   `json:"wait"`
+	Timeout     int    `json:"timeout"`
+}
+
+func (h *HelmReleaseRequest) Validate() error {
+	return validation.ValidateStruct(h,
+		validation.Field(&h.Server, validation.Required),
+		validation.Field(&h.Namespace, validation.Required),
+		validation.Field(&h.Name, validation.Required),
+		validation.Field(&h.Revision, validation.Min(0)),
+		validation.Field(&h.Timeout, validation.Min(0), validation.Max(3600)),
+	)
+}
+
+// HelmInstallRequest is a multipart form, the chart is the uploaded archive
+// or Chart, a path in the charts directory or the name of a chart of its
+// index at Version. DryRun only renders the manifests.
+type HelmInstallRequest struct {
+	Server          string `form:"server"`
+	Namespace       string `form:"namespace"`
+	Name            string `form:"name"`
+	Chart           string `form:"chart"`
+	Version         string `form:"version"`
+	Values          string `form:"values"`
+	CreateNamespace bool   `form:"create_namespace"`
+	DryRun          bool   `form:"dry_run"`
+	Wait            bool   `form:"wait"`
+	Timeout         int    `form:"timeout"`
+}
+
+func (h *HelmInstallRequest) Validate() error {
+	return validation.ValidateStruct(h,
+		validation.Field(&h.Server, validation.Required),
+		validation.Field(&h.Namespace, validation.Required),
+		validation.Field(&h.Name, validation.Required, validation.Length(1, 53)),
+		validation.Field(&h.Timeout, validation.Min(0), validation.Max(3600)),
+	)
+}
+
+// HelmLocalChart is a chart of the charts directory, Chart is the value to
+// install it with.
+type HelmLocalChart struct {
+	Chart       string `json:"chart"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"app_version"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+}
+
+// HelmManifest is the dry run of an install.
+type HelmManifest struct {
+	Manifest string `json:"manifest"`
+	Notes    string `json:"notes"`
+}
+
+// HelmDiffRequest compares the revision From with the revision To, 0 is the
+// current one for To and the one before To for From. With Values the current
+// revision is compared with an upgrade to these values instead.
+type HelmDiffRequest struct {
+	Server      string `json:"server"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	From        int    `json:"from"`
+	To          int    `json:"to"`
+	Values      string `json:"values"`
+	ReuseValues bool   `json:"reuse_values"`
+}
+
+func (h *HelmDiffRequest) Validate() error {
+	return validation.ValidateStruct(h,
+		validation.Field(&h.Server, validation.Required),
+		validation.Field(&h.Namespace, validation.Required),
+		validation.Field(&h.Name, validation.Required),
+		validation.Field(&h.From, validation.Min(0)),
+		validation.Field(&h.To, validation.Min(0)),
+	)
+}
+
+// HelmDiff - Values is the diff of the values supplied by the user,
+// ComputedValues of the values merged with the chart defaults. Objects only
+// lists the objects that changed. To is 0 for the proposed values.
+type HelmDiff struct {
+	From           int              `json:"from"`
+	To             int              `json:"to"`
+	Values         string           `json:"values"`
+	ComputedValues string           `json:"computed_values"`
+	Objects        []HelmObjectDiff `json:"objects"`
+}
+
+// Object changes of a HelmDiff.
+const (
+	ObjectAdded   = "added"
+	ObjectRemoved = "removed"
+	ObjectChanged = "changed"
+)
+
+type HelmObjectDiff struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Change     string `json:"change"`
+	Diff       string `json:"diff"`
+}
+
+// HelmRevision is a revision of the release history.
+type HelmRevision struct {
+	Revision    int       `json:"revision"`
+	Updated     time.Time `json:"updated"`
+	Status      string    `json:"status"`
+	Chart       string    `json:"chart"`
+	AppVersion  string    `json:"app_version"`
+	Description string    `json:"description"`
+}
+
+// Helm operation states, published to the topic of the operation.
+const (
+	HelmRunning = "running"
+	HelmDone    = "done"
+	HelmFailed  = "failed"
+)
+
+// HelmProgress is published while an operation on a release runs, Message
+// carries the helm log lines and the error once it failed.
+type HelmProgress struct {
+	Operation string `json:"operation"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	Revision  int    `json:"revision,omitempty"`
+}
+
 type TriggerCronjob struct {
 	Server    string `json:"server"`
 	Name      string `json:"name"`
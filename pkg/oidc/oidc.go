@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"teleskopio/pkg/config"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNoRole       = errors.New("no role mapped for the user")
+	ErrReservedName = errors.New("the system: names are reserved for kubernetes")
+)
+
+// reservedPrefix of the kubernetes users and groups, the provider must not
+// hand them out.
+const reservedPrefix = "system:"
+
+type Identity struct {
+	Username string
+	Groups   []string
+	Role     string
+}
+
+// Provider runs the authorization code flow. The provider discovery is done
+// on the first login so an unreachable issuer doesn't block the start.
+type Provider struct {
+	cfg config.OIDC
+
+	mu       sync.Mutex
+	verifier *gooidc.IDTokenVerifier
+	oauth2   *oauth2.Config
+}
+
+func New(cfg config.OIDC) *Provider {
+	return &Provider{cfg: cfg}
+}
+
+func (p *Provider) Enabled() bool {
+	return p.cfg.Enabled
+}
+
+func (p *Provider) init(ctx context.Context) (*oauth2.Config, *gooidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+	provider, err := gooidc.NewProvider(ctx, p.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	p.verifier = provider.Verifier(&gooidc.Config{ClientID: p.cfg.ClientID})
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+	return p.oauth2, p.verifier, nil
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	oauth2Config, _, err := p.init(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oauth2Config.AuthCodeURL(state, gooidc.Nonce(nonce)), nil
+}
+
+// Exchange trades the code for the ID token and maps its claims to the
+// teleskopio user.
+func (p *Provider) Exchange(ctx context.Context, code, nonce string) (Identity, error) {
+	var identity Identity
+	oauth2Config, verifier, err := p.init(ctx)
+	if err != nil {
+		return identity, err
+	}
+	token, err := oauth2Config.Exchange(ctx, code)
+	if err != nil {
+		return identity, fmt.Errorf("oidc exchange: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return identity, errors.New("oidc token response has no id_token")
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return identity, fmt.Errorf("oidc verify: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return identity, errors.New("oidc nonce mismatch")
+	}
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return identity, err
+	}
+	for _, claim := range []string{p.cfg.UsernameClaim, "email", "sub"} {
+		if v, ok := claims[claim].(string); ok && v != "" {
+			identity.Username = v
+			break
+		}
+	}
+	if groups, ok := claims[p.cfg.GroupsClaim].([]any); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	}
+	identity.Role = p.role(identity.Groups)
+	if identity.Role == "" {
+		return identity, ErrNoRole
+	}
+	identity.Username = p.cfg.UsernamePrefix + identity.Username
+	if strings.HasPrefix(identity.Username, reservedPrefix) {
+		return identity, ErrReservedName
+	}
+	groups := make([]string, 0, len(identity.Groups))
+	for _, g := range identity.Groups {
+		g = p.cfg.GroupsPrefix + g
+		if strings.HasPrefix(g, reservedPrefix) {
+			slog.Warn("oidc reserved group dropped", "user", identity.Username, "group", g)
+			continue
+		}
+		groups = append(groups, g)
+	}
+	identity.Groups = groups
+	return identity, nil
+}
+
+func (p *Provider) role(groups []string) string {
+	for _, m := range p.cfg.RoleMappings {
+		if slices.Contains(groups, m.Group) {
+			return m.Role
+		}
+	}
+	return p.cfg.DefaultRole
+}
@@ -0,0 +1,179 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"teleskopio/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newIssuer starts a stand-in OIDC issuer which answers every code with an
+// ID token carrying claims.
+func newIssuer(t *testing.T, claims jwt.MapClaims) *httptest.Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		//nolint:errcheck
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                srv.URL,
+			"authorization_endpoint":                srv.URL + "/auth",
+			"token_endpoint":                        srv.URL + "/token",
+			"jwks_uri":                              srv.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		//nolint:errcheck
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, _ *http.Request) {
+		idClaims := jwt.MapClaims{
+			"iss":   srv.URL,
+			"aud":   "teleskopio",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": "nonce",
+		}
+		for k, v := range claims {
+			idClaims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("sign id token: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		//nolint:errcheck
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProviderExchange(t *testing.T) {
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		defaultRole string
+		prefix      string
+		nonce       string
+		username    string
+		groups      []string
+		role        string
+		err         error
+	}{
+		{
+			name:     "group mapped to role",
+			claims:   jwt.MapClaims{"preferred_username": "jane", "groups": []string{"devs", "k8s-admins"}},
+			nonce:    "nonce",
+			username: "jane",
+			role:     "admin",
+		},
+		{
+			name:        "default role and email fallback",
+			claims:      jwt.MapClaims{"email": "joe@example.com", "groups": []string{"devs"}},
+			defaultRole: "viewer",
+			nonce:       "nonce",
+			username:    "joe@example.com",
+			role:        "viewer",
+		},
+		{
+			name:     "prefixed identity",
+			claims:   jwt.MapClaims{"preferred_username": "jane", "groups": []string{"k8s-admins", "system:masters"}},
+			prefix:   "oidc:",
+			nonce:    "nonce",
+			username: "oidc:jane",
+			groups:   []string{"oidc:k8s-admins", "oidc:system:masters"},
+			role:     "admin",
+		},
+		{
+			name:     "reserved groups dropped",
+			claims:   jwt.MapClaims{"preferred_username": "jane", "groups": []string{"k8s-admins", "system:masters"}},
+			nonce:    "nonce",
+			username: "jane",
+			groups:   []string{"k8s-admins"},
+			role:     "admin",
+		},
+		{
+			name:   "reserved username",
+			claims: jwt.MapClaims{"preferred_username": "system:admin", "groups": []string{"k8s-admins"}},
+			nonce:  "nonce",
+			err:    ErrReservedName,
+		},
+		{
+			name:   "no role mapped",
+			claims: jwt.MapClaims{"preferred_username": "joe"},
+			nonce:  "nonce",
+			err:    ErrNoRole,
+		},
+		{
+			name:   "nonce mismatch",
+			claims: jwt.MapClaims{"preferred_username": "jane", "groups": []string{"k8s-admins"}},
+			nonce:  "other",
+			err:    errors.New("oidc nonce mismatch"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newIssuer(t, tt.claims)
+			p := New(config.OIDC{
+				Enabled:        true,
+				Issuer:         issuer.URL,
+				ClientID:       "teleskopio",
+				RedirectURL:    "http://localhost:3080/api/oidc/callback",
+				Scopes:         []string{"openid"},
+				UsernameClaim:  "preferred_username",
+				GroupsClaim:    "groups",
+				RoleMappings:   []config.RoleMapping{{Group: "k8s-admins", Role: "admin"}},
+				DefaultRole:    tt.defaultRole,
+				UsernamePrefix: tt.prefix,
+				GroupsPrefix:   tt.prefix,
+			})
+			identity, err := p.Exchange(context.Background(), "code", tt.nonce)
+			if tt.err != nil {
+				if err == nil || err.Error() != tt.err.Error() {
+					t.Fatalf("expected error %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if identity.Username != tt.username || identity.Role != tt.role {
+				t.Fatalf("expected %s/%s, got %s/%s", tt.username, tt.role, identity.Username, identity.Role)
+			}
+			if tt.groups != nil && !slices.Equal(identity.Groups, tt.groups) {
+				t.Fatalf("expected groups %v, got %v", tt.groups, identity.Groups)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package rbac
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"teleskopio/pkg/config"
+)
+
+const (
+	Get     = "get"
+	List    = "list"
+	Watch   = "watch"
+	Create  = "create"
+	Update  = "update"
+	Delete  = "delete"
+	Scale   = "scale"
+	Drain   = "drain"
+	Trigger = "trigger"
+	Helm    = "helm"
+	Audit   = "audit"
+	// Exec - open a shell in the pod containers
+	Exec = "exec"
+	// PortForward - forward a port of the pods or services
+	PortForward = "portforward"
+	// Rollout - restart, pause, resume and undo the rollouts of the workloads
+	Rollout = "rollout"
+	// Clusters - add and remove clusters at runtime
+	Clusters = "clusters"
+
+	wildcard   = "*"
+	viewerRole = "viewer"
+	adminRole  = "admin"
+)
+
+var ErrForbidden = errors.New("access denied")
+
+var (
+	viewer = config.Role{
+		Name:  viewerRole,
+		Rules: []config.Rule{{Verbs: []string{Get, List, Watch}}},
+	}
+	admin = config.Role{
+		Name:  adminRole,
+		Rules: []config.Rule{{Verbs: []string{wildcard}}},
+	}
+)
+
+// Request - an empty Namespace stands for a cluster scoped object or for all
+// namespaces, an empty Kind matches any kind.
+type Request struct {
+	Role      string
+	Cluster   string
+	Namespace string
+	Kind      string
+	Verb      string
+}
+
+type Authorizer struct {
+	cfg     *config.Current
+	address func(cluster string) string
+
+	mu    sync.Mutex
+	built *config.Config
+	roles map[string]config.Role
+}
+
+// New - viewer is read only and admin has full access unless the config
+// redefines them, any other role missing in config has no access. Rules refer
+// to clusters by name or by the api server address resolved with address.
+func New(cfg *config.Current, address func(cluster string) string) *Authorizer {
+	return &Authorizer{cfg: cfg, address: address}
+}
+
+// current returns the roles of the current config, they're rebuilt after a
+// reload.
+func (a *Authorizer) current() (bool, map[string]config.Role) {
+	cfg := a.cfg.Get()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.built != cfg {
+		roles := map[string]config.Role{viewerRole: viewer, adminRole: admin}
+		for _, r := range cfg.Roles {
+			roles[r.Name] = r
+		}
+		a.built, a.roles = cfg, roles
+	}
+	return cfg.AuthDisabled, a.roles
+}
+
+func (a *Authorizer) Allowed(req Request) bool {
+	disabled, roles := a.current()
+	if disabled {
+		return true
+	}
+	if req.Role == "" {
+		return false
+	}
+	role, ok := roles[req.Role]
+	if !ok {
+		return false
+	}
+	return slices.ContainsFunc(role.Rules, func(rule config.Rule) bool {
+		return a.matchCluster(rule.Clusters, req.Cluster) &&
+			matchNamespace(rule.Namespaces, req.Namespace) &&
+			(req.Kind == "" || match(rule.Kinds, req.Kind)) &&
+			match(rule.Verbs, req.Verb)
+	})
+}
+
+// AllowedCluster reports whether the role has access to anything in the cluster.
+func (a *Authorizer) AllowedCluster(role, cluster string) bool {
+	disabled, roles := a.current()
+	if disabled {
+		return true
+	}
+	if role == "" {
+		return false
+	}
+	r, ok := roles[role]
+	if !ok {
+		return false
+	}
+	return slices.ContainsFunc(r.Rules, func(rule config.Rule) bool {
+		return a.matchCluster(rule.Clusters, cluster)
+	})
+}
+
+func (a *Authorizer) matchCluster(clusters []string, cluster string) bool {
+	if match(clusters, cluster) {
+		return true
+	}
+	address := a.address(cluster)
+	return address != "" && slices.Contains(clusters, address)
+}
+
+func match(values []string, value string) bool {
+	return len(values) == 0 || slices.Contains(values, wildcard) || slices.Contains(values, value)
+}
+
+func matchNamespace(namespaces []string, namespace string) bool {
+	if len(namespaces) == 0 || slices.Contains(namespaces, wildcard) {
+		return true
+	}
+	return namespace != "" && slices.Contains(namespaces, namespace)
+}
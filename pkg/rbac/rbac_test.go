@@ -0,0 +1,63 @@
+package rbac
+
+import (
+	"testing"
+
+	"teleskopio/pkg/config"
+)
+
+func TestAuthorizerAllowed(t *testing.T) {
+	addresses := map[string]string{"staging": "https://staging", "prod": "https://prod"}
+	a := New(config.NewCurrent(&config.Config{Roles: []config.Role{{
+		Name: "oncall",
+		Rules: []config.Rule{
+			{
+				Clusters:   []string{"staging"},
+				Namespaces: []string{"team-a"},
+				Kinds:      []string{"Deployment", "Pod"},
+				Verbs:      []string{Get, List, Watch, Update, Scale},
+			},
+			{
+				Clusters: []string{"https://staging"},
+				Kinds:    []string{"Namespace"},
+				Verbs:    []string{List},
+			},
+		},
+	}}}, &config.Users{}), func(cluster string) string { return addresses[cluster] })
+
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+	}{
+		{"scale in own namespace", Request{Role: "oncall", Cluster: "staging", Namespace: "team-a", Kind: "Deployment", Verb: Scale}, true},
+		{"scale in other namespace", Request{Role: "oncall", Cluster: "staging", Namespace: "team-b", Kind: "Deployment", Verb: Scale}, false},
+		{"list across namespaces", Request{Role: "oncall", Cluster: "staging", Kind: "Pod", Verb: List}, false},
+		{"delete not granted", Request{Role: "oncall", Cluster: "staging", Namespace: "team-a", Kind: "Pod", Verb: Delete}, false},
+		{"other cluster", Request{Role: "oncall", Cluster: "prod", Namespace: "team-a", Kind: "Pod", Verb: Get}, false},
+		{"drain nodes", Request{Role: "oncall", Cluster: "staging", Kind: "Node", Verb: Drain}, false},
+		{"cluster scoped rule", Request{Role: "oncall", Cluster: "staging", Kind: "Namespace", Verb: List}, true},
+		{"viewer reads", Request{Role: "viewer", Cluster: "prod", Kind: "Pod", Verb: List}, true},
+		{"viewer writes", Request{Role: "viewer", Cluster: "prod", Namespace: "default", Kind: "Pod", Verb: Delete}, false},
+		{"admin has full access", Request{Role: "admin", Cluster: "prod", Kind: "Node", Verb: Drain}, true},
+		{"undeclared role", Request{Role: "ops", Cluster: "prod", Kind: "Pod", Verb: Get}, false},
+		{"empty role", Request{Cluster: "prod", Kind: "Pod", Verb: Get}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Allowed(tt.req); got != tt.allowed {
+				t.Fatalf("expected %v, got %v", tt.allowed, got)
+			}
+		})
+	}
+
+	if a.AllowedCluster("oncall", "prod") {
+		t.Fatal("oncall must not see the prod cluster")
+	}
+	if !a.AllowedCluster("oncall", "staging") {
+		t.Fatal("oncall must see the staging cluster")
+	}
+	if a.AllowedCluster("ops", "staging") {
+		t.Fatal("an undeclared role must not see any cluster")
+	}
+}
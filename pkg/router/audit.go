@@ -0,0 +1,46 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	"teleskopio/pkg/audit"
+	"teleskopio/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Route) ListAudit(c *gin.Context) {
+	var f audit.Filter
+	if err := c.ShouldBindQuery(&f); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Verb: rbac.Audit}) {
+		return
+	}
+	entries, err := r.audit.Query(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// record audits the operation made by the user of the request, err is the
+// result of the operation.
+func (r *Route) record(c *gin.Context, e audit.Entry, err error) {
+	e.User = c.GetString("username")
+	e.Role = c.GetString("role")
+	switch {
+	case err == nil:
+		e.Outcome = audit.Success
+	case errors.Is(err, rbac.ErrForbidden):
+		e.Outcome = audit.Denied
+		e.Error = err.Error()
+	default:
+		e.Outcome = audit.Failure
+		e.Error = err.Error()
+	}
+	r.audit.Record(e)
+}
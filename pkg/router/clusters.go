@@ -0,0 +1,114 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"teleskopio/pkg/audit"
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (r *Route) AddCluster(c *gin.Context) {
+	var req model.AddClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Verb: rbac.Clusters}) {
+		return
+	}
+	if req.Persist && !r.store.Enabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "persist needs the clusters store, it's not configured"})
+		return
+	}
+	cluster, err := r.cfg.Get().Kube.FromKubeconfig([]byte(req.Kubeconfig), req.Context, req.Alias, req.Labels)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	err = r.kapi.AddCluster(cluster)
+	if err == nil && req.Persist {
+		err = r.store.Add(config.StoredCluster{
+			Name:       cluster.Name,
+			Context:    req.Context,
+			Labels:     cluster.Labels,
+			Kubeconfig: req.Kubeconfig,
+		})
+		if err != nil {
+			// not persisted, it's not added either
+			//nolint:errcheck
+			r.kapi.RemoveCluster(cluster.Name)
+		}
+	}
+	r.record(c, audit.Entry{
+		Cluster:   cluster.Name,
+		Operation: "add_cluster",
+		Payload:   gin.H{"server": cluster.Address, "labels": cluster.Labels, "persist": req.Persist},
+	}, err)
+	if err != nil {
+		slog.Error("add cluster", "err", err.Error(), "name", cluster.Name)
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, model.Cluster{Server: cluster.Name, Name: cluster.Name, Address: cluster.Address, Labels: cluster.Labels})
+}
+
+func (r *Route) RemoveCluster(c *gin.Context) {
+	var req model.PayloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Verb: rbac.Clusters}) {
+		return
+	}
+	// the clusters of the config file come back with the next reload
+	if r.kapi.ConfiguredCluster(req.Server) && !r.store.Has(req.Server) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("cluster %s is configured in the config file, remove it there", req.Server)})
+		return
+	}
+	err := r.kapi.RemoveCluster(req.Server)
+	if err == nil {
+		err = r.store.Remove(req.Server)
+	}
+	r.record(c, audit.Entry{Cluster: req.Server, Operation: "remove_cluster"}, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": ""})
+}
+
+func (r *Route) TestCluster(c *gin.Context) {
+	var req model.PayloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowedCluster(c, req.Server) {
+		return
+	}
+	status, err := r.kapi.TestCluster(req.Server)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
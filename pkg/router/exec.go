@@ -0,0 +1,187 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"teleskopio/pkg/audit"
+	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// upgrader of the websockets served by the handlers, the hub has its own.
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// ExecPod attaches the websocket to a command in the container, the session
+// ends when the command exits, the client disconnects or the token expires.
+func (r *Route) ExecPod(c *gin.Context) {
+	var req model.ExecRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: "Pod", Verb: rbac.Exec}) {
+		return
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.Error("exec upgrade", "err", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	if claims, ok := model.ClaimsFromContext(ctx); ok && claims.ExpiresAt != nil {
+		ctx, cancel = context.WithDeadline(ctx, claims.ExpiresAt.Time)
+		defer cancel()
+	}
+	s := newExecSession(conn)
+	go s.readPump(cancel)
+
+	slog.Debug("exec started", "pod", req.Name, "ns", req.Namespace, "container", req.Container)
+	// the session may last for hours, it's recorded once it starts and again
+	// with its outcome
+	entry := audit.Entry{
+		Cluster:   req.Server,
+		Namespace: req.Namespace,
+		Kind:      "Pod",
+		Name:      req.Name,
+		Operation: rbac.Exec + " start",
+		Payload:   gin.H{"container": req.Container, "command": req.Command},
+	}
+	r.record(c, entry, nil)
+	started := time.Now()
+	err = r.kapi.Exec(ctx, req, remotecommand.StreamOptions{
+		Stdin:             s.stdin,
+		Stdout:            s.writer(model.ExecStdout),
+		Stderr:            s.writer(model.ExecStderr),
+		TerminalSizeQueue: s,
+	})
+	entry.Operation = rbac.Exec + " end"
+	entry.Payload = gin.H{"container": req.Container, "command": req.Command, "duration": time.Since(started).Round(time.Second).String()}
+	r.record(c, entry, err)
+	s.exit(err)
+}
+
+// execSession adapts the websocket frames to the exec streams.
+type execSession struct {
+	conn   *websocket.Conn
+	mu     sync.Mutex
+	stdin  *io.PipeReader
+	input  *io.PipeWriter
+	resize chan remotecommand.TerminalSize
+	done   chan struct{}
+}
+
+func newExecSession(conn *websocket.Conn) *execSession {
+	stdin, input := io.Pipe()
+	return &execSession{
+		conn:   conn,
+		stdin:  stdin,
+		input:  input,
+		resize: make(chan remotecommand.TerminalSize, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// readPump feeds stdin and the terminal size until the client goes away.
+func (s *execSession) readPump(cancel context.CancelFunc) {
+	defer func() {
+		close(s.done)
+		s.input.Close()
+		cancel()
+	}()
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg model.ExecMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			slog.Debug("invalid exec message", "err", err.Error())
+			continue
+		}
+		switch msg.Type {
+		case model.ExecStdin:
+			if _, err := s.input.Write(msg.Data); err != nil {
+				return
+			}
+		case model.ExecResize:
+			size := remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}
+			// only the latest size matters
+			select {
+			case <-s.resize:
+			default:
+			}
+			s.resize <- size
+		default:
+			slog.Debug("unsupported exec message", "type", msg.Type)
+		}
+	}
+}
+
+// Next implements remotecommand.TerminalSizeQueue, nil ends the queue.
+func (s *execSession) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-s.resize:
+		return &size
+	case <-s.done:
+		return nil
+	}
+}
+
+func (s *execSession) send(msg model.ExecMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//nolint:errcheck
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *execSession) exit(err error) {
+	// unblocks the pending stdin writes
+	s.stdin.Close()
+	msg := model.ExecMessage{Type: model.ExecExit}
+	if err != nil {
+		msg.Error = err.Error()
+	}
+	//nolint:errcheck
+	s.send(msg)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//nolint:errcheck
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+func (s *execSession) writer(typ string) io.Writer {
+	return execWriter{session: s, typ: typ}
+}
+
+type execWriter struct {
+	session *execSession
+	typ     string
+}
+
+func (w execWriter) Write(p []byte) (int, error) {
+	if err := w.session.send(model.ExecMessage{Type: w.typ, Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
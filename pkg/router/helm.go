@@ -1,23 +1,47 @@
 package router
 
 import (
-	"encoding/json"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	icache "teleskopio/pkg/cache"
+	"teleskopio/pkg/audit"
+	"teleskopio/pkg/kubeapi"
 	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
 
 	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/release"
-	v1 "k8s.io/api/core/v1"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/repo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
+// ListHelmReleases serves the latest revision of every release from the
+// cluster wide informer, Namespaces narrows the list down when it's set. The
+// informers of Namespaces serve the user who can't list the secrets of the
+// cluster.
 func (r *Route) ListHelmReleases(c *gin.Context) {
 	var req model.HelmChart
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -25,88 +49,138 @@ func (r *Route) ListHelmReleases(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	flags := genericclioptions.NewConfigFlags(false)
-	// Spoof kube config on the fly
-	server, err := r.kapi.GetClient(req.Server)
+	if !r.allowedCluster(c, req.Server) {
+		return
+	}
+	ctx := c.Request.Context()
+	user := r.impersonatedUser(c)
+	identity := r.kapi.Impersonated(ctx)
+	addedTopic := watchTopic("helm-release", req.Server, "", identity, "added")
+	updatedTopic := watchTopic("helm-release", req.Server, "", identity, "updated")
+	deletedTopic := watchTopic("helm-release", req.Server, "", identity, "deleted")
+	// superseded revisions are skipped, the newer revision is published on
+	// its own and must not be replaced by them
+	publish := func(topic string, obj any) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		sec, ok := obj.(*unstructured.Unstructured)
+		if !ok || sec.GetLabels()["status"] == release.StatusSuperseded.String() {
+			return
+		}
+		rel, err := secretRelease(sec)
+		if err != nil {
+			slog.Error("cant decode helm release", "ns", sec.GetNamespace(), "secret", sec.GetName(), "err", err.Error())
+			return
+		}
+		// the informer is cluster wide, the release goes to the subscribers
+		// allowed in its namespace only
+		r.hub.PublishAllowed(user, topic, rel, func(claims *model.Claims) bool {
+			var role string
+			if claims != nil {
+				role = claims.Role
+			}
+			return r.rbac.Allowed(rbac.Request{Role: role, Cluster: req.Server, Namespace: rel.Namespace, Verb: rbac.Helm})
+		})
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			publish(addedTopic, obj)
+		},
+		UpdateFunc: func(_, newObj any) {
+			publish(updatedTopic, newObj)
+		},
+		DeleteFunc: func(obj any) {
+			publish(deletedTopic, obj)
+		},
+	}
+	topics := []string{addedTopic, updatedTopic, deletedTopic}
+	secrets, err := r.helmReleaseSecrets(ctx, req.Server, req.Namespaces, topics, handler)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	flags.WrapConfigFn = func(_ *rest.Config) *rest.Config {
-		return server.RestConfig
-	}
-	var result []*release.Release
-	slog.Debug("get releases", "ns", len(req.Namespaces))
-	for _, ns := range req.Namespaces {
-		actionConfig := new(action.Configuration)
-		if err := actionConfig.Init(flags, ns, "secret", slog.Default().Info); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
-			return
+
+	allowed := map[string]bool{}
+	result := []release.Release{}
+	for _, sec := range latestReleaseSecrets(secrets) {
+		ns := sec.GetNamespace()
+		if len(req.Namespaces) > 0 && !slices.Contains(req.Namespaces, ns) {
+			continue
 		}
+		ok, seen := allowed[ns]
+		if !seen {
+			ok = r.rbac.Allowed(rbac.Request{Role: c.GetString("role"), Cluster: req.Server, Namespace: ns, Verb: rbac.Helm})
+			allowed[ns] = ok
+		}
+		if !ok {
+			continue
+		}
+		rel, err := secretRelease(&sec)
+		if err != nil {
+			slog.Error("cant decode helm release", "ns", ns, "secret", sec.GetName(), "err", err.Error())
+			continue
+		}
+		result = append(result, rel)
+	}
 
-		list := action.NewList(actionConfig)
-		list.All = true
+	c.JSON(http.StatusOK, gin.H{
+		"charts":  result,
+		"added":   r.subscription(c, addedTopic),
+		"updated": r.subscription(c, updatedTopic),
+		"deleted": r.subscription(c, deletedTopic),
+	})
+}
 
-		rels, err := list.Run()
+// helmReleaseSecrets watches and lists the release secrets of the cluster.
+// The user who can't list the secrets cluster wide, like an impersonated
+// one, gets the ones of the requested namespaces instead.
+func (r *Route) helmReleaseSecrets(ctx context.Context, server string, namespaces, topics []string, handler cache.ResourceEventHandler) ([]unstructured.Unstructured, error) {
+	watch := func(namespace string) ([]unstructured.Unstructured, error) {
+		if err := r.kapi.WatchHelmReleases(ctx, server, namespace, topics, handler); err != nil {
+			return nil, err
+		}
+		return r.kapi.HelmReleaseSecrets(ctx, server, namespace)
+	}
+	secrets, err := watch("")
+	if !apierrors.IsForbidden(err) {
+		return secrets, err
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("%w, select the namespaces of the releases", err)
+	}
+	secrets = nil
+	for _, ns := range namespaces {
+		nsSecrets, err := watch(ns)
 		if err != nil {
-			slog.Error("cant get releases", "ns", ns, "err", err.Error())
-			continue
+			return nil, err
 		}
+		secrets = append(secrets, nsSecrets...)
+	}
+	return secrets, nil
+}
 
-		result = append(result, rels...)
-	}
-
-	// TODO stop all watchers
-	if _, ok := r.helmWathers.Load(req.Server); !ok {
-		r.helmWathers.Store(
-			req.Server,
-			icache.NewCacheInformers(c.Request.Context(), make(chan struct{}), server.Typed, cache.ResourceEventHandlerFuncs{
-				AddFunc: func(obj any) {
-					sec := obj.(*v1.Secret)
-					slog.Debug("add", "sec", sec.Labels)
-					rel, err := decodeHelmRelease(sec.Data["release"])
-					if err != nil {
-						slog.Error("cant add releases", "ns", sec.Namespace, "err", err.Error())
-						return
-					}
-					payload, _ := json.Marshal(map[string]interface{}{
-						"event":   fmt.Sprintf("helm-release-%s-added", req.Server),
-						"payload": rel,
-					})
-					r.hub.Broadcast(payload)
-				},
-				UpdateFunc: func(_, newObj any) {
-					sec := newObj.(*v1.Secret)
-					slog.Debug("update", "sec", sec.Labels)
-					rel, err := decodeHelmRelease(sec.Data["release"])
-					if err != nil {
-						slog.Error("cant update releases", "ns", sec.Namespace, "err", err.Error())
-						return
-					}
-					payload, _ := json.Marshal(map[string]interface{}{
-						"event":   fmt.Sprintf("helm-release-%s-updated", req.Server),
-						"payload": rel,
-					})
-					r.hub.Broadcast(payload)
-				},
-				DeleteFunc: func(obj any) {
-					sec := obj.(*v1.Secret)
-					slog.Debug("delete", "sec", sec.Labels)
-					rel, err := decodeHelmRelease(sec.Data["release"])
-					if err != nil {
-						slog.Error("cant delete releases", "ns", sec.Namespace, "err", err.Error())
-						return
-					}
-					payload, _ := json.Marshal(map[string]interface{}{
-						"event":   fmt.Sprintf("helm-release-%s-deleted", req.Server),
-						"payload": rel,
-					})
-					r.hub.Broadcast(payload)
-				},
-			}))
-	}
-
-	c.JSON(http.StatusOK, gin.H{"charts": result})
+// latestReleaseSecrets keeps the secret of the last revision of every release,
+// like helm list does.
+func latestReleaseSecrets(secrets []unstructured.Unstructured) []unstructured.Unstructured {
+	latest := map[string]unstructured.Unstructured{}
+	revision := func(sec unstructured.Unstructured) int {
+		v, _ := strconv.Atoi(sec.GetLabels()["version"])
+		return v
+	}
+	for _, sec := range secrets {
+		key := sec.GetNamespace() + "/" + sec.GetLabels()["name"]
+		if prev, ok := latest[key]; ok && revision(prev) >= revision(sec) {
+			continue
+		}
+		latest[key] = sec
+	}
+	return slices.SortedFunc(maps.Values(latest), func(a, b unstructured.Unstructured) int {
+		if c := strings.Compare(a.GetNamespace(), b.GetNamespace()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.GetLabels()["name"], b.GetLabels()["name"])
+	})
 }
 
 func (r *Route) GetHelmRelease(c *gin.Context) {
@@ -116,29 +190,683 @@ func (r *Route) GetHelmRelease(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	flags := genericclioptions.NewConfigFlags(false)
-	// Spoof kube config on the fly
-	server, err := r.kapi.GetClient(req.Server)
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Verb: rbac.Helm}) {
+		return
+	}
+	actionConfig, err := r.helmConfig(c.Request.Context(), req.Server, req.Namespace, slog.Default().Info)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	list := action.NewGet(actionConfig)
+
+	rel, err := list.Run(req.Name)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rel})
+}
+
+// helmConfig builds the helm configuration of the namespace with the client
+// of the user, log gets the debug lines of the actions.
+func (r *Route) helmConfig(ctx context.Context, server, namespace string, log action.DebugLog) (*action.Configuration, error) {
+	cluster, err := r.kapi.GetClient(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	flags := genericclioptions.NewConfigFlags(false)
+	// Spoof kube config on the fly
 	flags.WrapConfigFn = func(_ *rest.Config) *rest.Config {
-		return server.RestConfig
+		return cluster.RestConfig
 	}
+	// the objects of the chart without a namespace go to the release one
+	flags.Namespace = &namespace
 	actionConfig := new(action.Configuration)
-	if err := actionConfig.Init(flags, req.Namespace, "secret", slog.Default().Info); err != nil {
+	if err := actionConfig.Init(flags, namespace, "secret", log); err != nil {
+		return nil, err
+	}
+	return actionConfig, nil
+}
+
+// HelmHistory lists the revisions of the release, oldest first.
+func (r *Route) HelmHistory(c *gin.Context) {
+	var req model.HelmRelease
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Verb: rbac.Helm}) {
+		return
+	}
+	actionConfig, err := r.helmConfig(c.Request.Context(), req.Server, req.Namespace, slog.Default().Debug)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	history := action.NewHistory(actionConfig)
+	history.Max = 256
+	rels, err := history.Run(req.Name)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	slices.SortFunc(rels, func(a, b *release.Release) int { return a.Version - b.Version })
+	revisions := make([]model.HelmRevision, 0, len(rels))
+	for _, rel := range rels {
+		rev := model.HelmRevision{Revision: rel.Version}
+		if rel.Info != nil {
+			rev.Updated = rel.Info.LastDeployed.Time
+			rev.Status = rel.Info.Status.String()
+			rev.Description = rel.Info.Description
+		}
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			rev.Chart = rel.Chart.Metadata.Name + "-" + rel.Chart.Metadata.Version
+			rev.AppVersion = rel.Chart.Metadata.AppVersion
+		}
+		revisions = append(revisions, rev)
+	}
+	c.JSON(http.StatusOK, revisions)
+}
 
-	list := action.NewGet(actionConfig)
+// HelmRollback rolls the release back to a revision, the previous one when
+// it's 0.
+func (r *Route) HelmRollback(c *gin.Context) {
+	r.helmOperation(c, "rollback", func(_ context.Context, actionConfig *action.Configuration, req model.HelmReleaseRequest) (int, error) {
+		rollback := action.NewRollback(actionConfig)
+		rollback.Version = req.Revision
+		rollback.Wait = req.Wait
+		rollback.Timeout = helmTimeout(req.Timeout)
+		if err := rollback.Run(req.Name); err != nil {
+			return 0, err
+		}
+		rel, err := actionConfig.Releases.Last(req.Name)
+		if err != nil {
+			return 0, err
+		}
+		return rel.Version, nil
+	})
+}
 
-	rel, err := list.Run(req.Name)
+// HelmUninstall removes the release, KeepHistory keeps its revisions so it
+// can be rolled back.
+func (r *Route) HelmUninstall(c *gin.Context) {
+	r.helmOperation(c, "uninstall", func(_ context.Context, actionConfig *action.Configuration, req model.HelmReleaseRequest) (int, error) {
+		uninstall := action.NewUninstall(actionConfig)
+		uninstall.KeepHistory = req.KeepHistory
+		uninstall.Wait = req.Wait
+		uninstall.Timeout = helmTimeout(req.Timeout)
+		res, err := uninstall.Run(req.Name)
+		if err != nil || res.Release == nil {
+			return 0, err
+		}
+		return res.Release.Version, nil
+	})
+}
+
+// HelmUpgrade upgrades the release with new values against the chart stored
+// in the release. The upgrade fails when an object of the rendered release
+// isn't allowed to the user.
+func (r *Route) HelmUpgrade(c *gin.Context) {
+	authorize := r.releaseAuthorizer(c)
+	r.helmOperation(c, "upgrade", func(ctx context.Context, actionConfig *action.Configuration, req model.HelmReleaseRequest) (int, error) {
+		values, err := chartutil.ReadValues([]byte(req.Values))
+		if err != nil {
+			return 0, err
+		}
+		current, err := action.NewGet(actionConfig).Run(req.Name)
+		if err != nil {
+			return 0, err
+		}
+		newUpgrade := func() *action.Upgrade {
+			upgrade := action.NewUpgrade(actionConfig)
+			upgrade.Namespace = req.Namespace
+			upgrade.ReuseValues = req.ReuseValues
+			// the values of the request replace the ones of the release
+			upgrade.ResetValues = !req.ReuseValues
+			upgrade.Wait = req.Wait
+			upgrade.Timeout = helmTimeout(req.Timeout)
+			return upgrade
+		}
+		// rendered first, nothing is upgraded when an object is denied
+		dryRun := newUpgrade()
+		dryRun.DryRun = true
+		dryRun.DryRunOption = "client"
+		rendered, err := dryRun.RunWithContext(ctx, req.Name, current.Chart, values)
+		if err != nil {
+			return 0, err
+		}
+		if err := authorize(req.Server, rendered); err != nil {
+			return 0, err
+		}
+		rel, err := newUpgrade().RunWithContext(ctx, req.Name, current.Chart, values)
+		if err != nil {
+			return 0, err
+		}
+		return rel.Version, nil
+	})
+}
+
+// HelmDiff compares two revisions of the release, or the current one with an
+// upgrade to new values.
+func (r *Route) HelmDiff(c *gin.Context) {
+	var req model.HelmDiffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Verb: rbac.Helm}) {
+		return
+	}
+	actionConfig, err := r.helmConfig(c.Request.Context(), req.Server, req.Namespace, slog.Default().Debug)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	from, to, err := diffedReleases(c.Request.Context(), actionConfig, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	diff, err := helmDiff(from, to)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if req.Values != "" {
+		diff.To = 0
+	}
+	c.JSON(http.StatusOK, diff)
+}
 
-	c.JSON(http.StatusOK, gin.H{"data": rel})
+// diffedReleases reads the revisions of the request, the proposed values are
+// rendered by a dry run of the upgrade.
+func diffedReleases(ctx context.Context, actionConfig *action.Configuration, req model.HelmDiffRequest) (*release.Release, *release.Release, error) {
+	get := action.NewGet(actionConfig)
+	get.Version = req.To
+	if req.Values != "" {
+		get.Version = 0
+	}
+	to, err := get.Run(req.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Values != "" {
+		values, err := chartutil.ReadValues([]byte(req.Values))
+		if err != nil {
+			return nil, nil, err
+		}
+		upgrade := action.NewUpgrade(actionConfig)
+		upgrade.Namespace = req.Namespace
+		upgrade.ReuseValues = req.ReuseValues
+		upgrade.ResetValues = !req.ReuseValues
+		upgrade.DryRun = true
+		upgrade.DryRunOption = "client"
+		proposed, err := upgrade.RunWithContext(ctx, req.Name, to.Chart, values)
+		return to, proposed, err
+	}
+	get.Version = req.From
+	if req.From == 0 {
+		get.Version = to.Version - 1
+	}
+	if get.Version < 1 {
+		return nil, nil, fmt.Errorf("release %s has no revision before %d", req.Name, to.Version)
+	}
+	from, err := get.Run(req.Name)
+	return from, to, err
+}
+
+// helmDiff diffs the values and the rendered objects of the releases.
+func helmDiff(from, to *release.Release) (model.HelmDiff, error) {
+	diff := model.HelmDiff{From: from.Version, To: to.Version, Objects: []model.HelmObjectDiff{}}
+	fromName, toName := strconv.Itoa(from.Version), strconv.Itoa(to.Version)
+	var err error
+	if diff.Values, err = valuesDiff(from.Config, to.Config, fromName, toName); err != nil {
+		return diff, err
+	}
+	fromComputed, err := chartutil.CoalesceValues(from.Chart, from.Config)
+	if err != nil {
+		return diff, err
+	}
+	toComputed, err := chartutil.CoalesceValues(to.Chart, to.Config)
+	if err != nil {
+		return diff, err
+	}
+	if diff.ComputedValues, err = valuesDiff(fromComputed, toComputed, fromName, toName); err != nil {
+		return diff, err
+	}
+	fromObjects, err := releaseObjects(from)
+	if err != nil {
+		return diff, err
+	}
+	toObjects, err := releaseObjects(to)
+	if err != nil {
+		return diff, err
+	}
+	keys := slices.Sorted(maps.Keys(toObjects))
+	for key := range fromObjects {
+		if _, found := toObjects[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		a, b := fromObjects[key], toObjects[key]
+		obj := b
+		switch {
+		case a.manifest == "":
+			obj.Change = model.ObjectAdded
+		case b.manifest == "":
+			obj = a
+			obj.Change = model.ObjectRemoved
+		case a.manifest != b.manifest:
+			obj.Change = model.ObjectChanged
+		default:
+			continue
+		}
+		if obj.Diff, err = kubeapi.UnifiedDiff(a.manifest, b.manifest, fromName, toName); err != nil {
+			return diff, err
+		}
+		diff.Objects = append(diff.Objects, obj.HelmObjectDiff)
+	}
+	return diff, nil
+}
+
+func valuesDiff(a, b map[string]any, from, to string) (string, error) {
+	aYAML, err := chartutil.Values(a).YAML()
+	if err != nil {
+		return "", err
+	}
+	bYAML, err := chartutil.Values(b).YAML()
+	if err != nil {
+		return "", err
+	}
+	return kubeapi.UnifiedDiff(aYAML, bYAML, from, to)
+}
+
+type releaseObject struct {
+	model.HelmObjectDiff
+	manifest string
+}
+
+// releaseObjects splits the manifests of the release and of its hooks by
+// object, keyed by kind, namespace and name so an apiVersion bump is a change.
+func releaseObjects(rel *release.Release) (map[string]releaseObject, error) {
+	docs := slices.Collect(maps.Values(releaseutil.SplitManifests(rel.Manifest)))
+	for _, h := range rel.Hooks {
+		docs = append(docs, h.Manifest)
+	}
+	objects := map[string]releaseObject{}
+	for _, doc := range docs {
+		var meta struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &meta); err != nil {
+			return nil, err
+		}
+		if meta.Kind == "" {
+			continue
+		}
+		obj := releaseObject{manifest: strings.TrimSpace(doc) + "\n"}
+		obj.APIVersion, obj.Kind = meta.APIVersion, meta.Kind
+		obj.Namespace, obj.Name = meta.Metadata.Namespace, meta.Metadata.Name
+		objects[obj.Kind+"/"+obj.Namespace+"/"+obj.Name] = obj
+	}
+	return objects, nil
+}
+
+const (
+	// maxChartUpload is the largest request of an install, the uploaded
+	// chart archive included.
+	maxChartUpload = 20 << 20
+	// indexFile is the index of the local repository in the charts directory.
+	indexFile = "index.yaml"
+)
+
+// HelmLocalCharts lists the charts offered for install.
+func (r *Route) HelmLocalCharts(c *gin.Context) {
+	charts, err := localCharts(r.cfg.Get().Helm.ChartsDir)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, charts)
+}
+
+// HelmInstall installs the uploaded chart archive or a chart of the charts
+// directory, a dry run returns the rendered manifests instead. The install
+// fails when an object of the chart isn't allowed to the user.
+func (r *Route) HelmInstall(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxChartUpload)
+	var req model.HelmInstallRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Verb: rbac.Helm}) {
+		return
+	}
+	if req.CreateNamespace && !req.DryRun && !r.allowed(c, rbac.Request{Cluster: req.Server, Kind: "Namespace", Verb: rbac.Create}) {
+		return
+	}
+	ch, err := loadChart(c, r.cfg.Get().Helm.ChartsDir, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if deps := ch.Metadata.Dependencies; len(deps) > 0 {
+		// offline, the dependencies must be in the charts of the chart
+		if err := action.CheckDependencies(ch, deps); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	values, err := chartutil.ReadValues([]byte(req.Values))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	newInstall := func(actionConfig *action.Configuration) *action.Install {
+		install := action.NewInstall(actionConfig)
+		install.ReleaseName = req.Name
+		install.Namespace = req.Namespace
+		install.CreateNamespace = req.CreateNamespace
+		install.Wait = req.Wait
+		install.Timeout = helmTimeout(req.Timeout)
+		return install
+	}
+	if req.DryRun {
+		actionConfig, err := r.helmConfig(c.Request.Context(), req.Server, req.Namespace, slog.Default().Debug)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		install := newInstall(actionConfig)
+		install.DryRun = true
+		install.DryRunOption = "client"
+		rel, err := install.RunWithContext(c.Request.Context(), ch, values)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, renderedRelease(rel))
+		return
+	}
+	payload := gin.H{"chart": ch.Metadata.Name, "version": ch.Metadata.Version, "create_namespace": req.CreateNamespace}
+	authorize := r.releaseAuthorizer(c)
+	r.startHelmOperation(c, req.Server, req.Namespace, req.Name, "install", payload, func(ctx context.Context, actionConfig *action.Configuration) (int, error) {
+		// rendered first, nothing is installed when an object is denied
+		dryRun := newInstall(actionConfig)
+		dryRun.DryRun = true
+		dryRun.DryRunOption = "client"
+		rendered, err := dryRun.RunWithContext(ctx, ch, values)
+		if err != nil {
+			return 0, err
+		}
+		if err := authorize(req.Server, rendered); err != nil {
+			return 0, err
+		}
+		rel, err := newInstall(actionConfig).RunWithContext(ctx, ch, values)
+		if err != nil {
+			return 0, err
+		}
+		return rel.Version, nil
+	})
+}
+
+// releaseAuthorizer checks every object of the rendered release, the hooks
+// included, can be created and updated by the user. The namespaced objects
+// without a namespace land in the one of the release, a kind the cluster
+// doesn't know yet, like the one of a CRD of the chart, is checked as
+// cluster scoped. It's called once the request is over.
+func (r *Route) releaseAuthorizer(c *gin.Context) func(server string, rel *release.Release) error {
+	cc := c.Copy()
+	return func(server string, rel *release.Release) error {
+		authorize := r.objectAuthorizer(cc, server, rbac.Create, rbac.Update)
+		objects, err := releaseObjects(rel)
+		if err != nil {
+			return err
+		}
+		for _, key := range slices.Sorted(maps.Keys(objects)) {
+			o := objects[key]
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion(o.APIVersion)
+			obj.SetKind(o.Kind)
+			obj.SetName(o.Name)
+			gvk := obj.GroupVersionKind()
+			res := model.APIResource{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}
+			if err := r.kapi.ResolveResource(server, &res); err == nil && res.Namespaced {
+				obj.SetNamespace(cmp.Or(o.Namespace, rel.Namespace))
+			}
+			if err := authorize(obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// renderedRelease joins the manifests of the release and of its hooks like
+// helm template does.
+func renderedRelease(rel *release.Release) model.HelmManifest {
+	var b strings.Builder
+	b.WriteString(rel.Manifest)
+	for _, h := range rel.Hooks {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+	}
+	m := model.HelmManifest{Manifest: b.String()}
+	if rel.Info != nil {
+		m.Notes = rel.Info.Notes
+	}
+	return m
+}
+
+// loadChart reads the uploaded archive, the chart of the charts directory
+// otherwise.
+func loadChart(c *gin.Context, dir string, req model.HelmInstallRequest) (*chart.Chart, error) {
+	fh, err := c.FormFile("archive")
+	if errors.Is(err, http.ErrMissingFile) {
+		return localChart(dir, req.Chart, req.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return loader.LoadArchive(f)
+}
+
+// localChart loads a chart directory or archive of the charts directory,
+// name is looked up in the index.yaml of the directory when it's not a path.
+func localChart(dir, name, version string) (*chart.Chart, error) {
+	if dir == "" {
+		return nil, errors.New("no charts directory is configured, upload the chart archive")
+	}
+	if name == "" {
+		return nil, errors.New("chart or archive is required")
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("chart %s is outside of the charts directory", name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		return loader.Load(filepath.Join(dir, name))
+	}
+	index, err := repo.LoadIndexFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("chart %s not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cv, err := index.Get(name, version)
+	if err != nil {
+		return nil, fmt.Errorf("chart %s %s: %w", name, version, err)
+	}
+	if path, ok := indexedArchive(cv); ok {
+		return loader.Load(filepath.Join(dir, path))
+	}
+	return nil, fmt.Errorf("chart %s %s has no archive in the charts directory", name, cv.Version)
+}
+
+// localCharts lists the chart directories and archives of dir and the
+// charts of its index with a local archive.
+func localCharts(dir string) ([]model.HelmLocalChart, error) {
+	charts := []model.HelmLocalChart{}
+	if dir == "" {
+		return charts, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		source := "directory"
+		if !e.IsDir() {
+			if !strings.HasSuffix(e.Name(), ".tgz") {
+				continue
+			}
+			source = "archive"
+		}
+		ch, err := loader.Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			slog.Debug("skip local chart", "path", e.Name(), "err", err.Error())
+			continue
+		}
+		charts = append(charts, model.HelmLocalChart{
+			Chart:       e.Name(),
+			Name:        ch.Metadata.Name,
+			Version:     ch.Metadata.Version,
+			AppVersion:  ch.Metadata.AppVersion,
+			Description: ch.Metadata.Description,
+			Source:      source,
+		})
+	}
+	index, err := repo.LoadIndexFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return charts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, versions := range index.Entries {
+		for _, cv := range versions {
+			if _, ok := indexedArchive(cv); !ok {
+				continue
+			}
+			charts = append(charts, model.HelmLocalChart{
+				Chart:       name,
+				Name:        name,
+				Version:     cv.Version,
+				AppVersion:  cv.AppVersion,
+				Description: cv.Description,
+				Source:      "index",
+			})
+		}
+	}
+	slices.SortStableFunc(charts, func(a, b model.HelmLocalChart) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return charts, nil
+}
+
+// indexedArchive returns the first url of the chart relative to the index,
+// the remote ones are skipped, the install works offline.
+func indexedArchive(cv *repo.ChartVersion) (string, bool) {
+	for _, u := range cv.URLs {
+		parsed, err := url.Parse(u)
+		if err == nil && parsed.Scheme == "" && filepath.IsLocal(u) {
+			return u, true
+		}
+	}
+	return "", false
+}
+
+// helmOperation binds the request of an operation on a release and starts
+// it.
+func (r *Route) helmOperation(c *gin.Context, operation string, run func(context.Context, *action.Configuration, model.HelmReleaseRequest) (int, error)) {
+	var req model.HelmReleaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Verb: rbac.Helm}) {
+		return
+	}
+	payload := gin.H{"revision": req.Revision, "keep_history": req.KeepHistory, "reuse_values": req.ReuseValues}
+	r.startHelmOperation(c, req.Server, req.Namespace, req.Name, operation, payload, func(ctx context.Context, actionConfig *action.Configuration) (int, error) {
+		return run(ctx, actionConfig, req)
+	})
+}
+
+// startHelmOperation runs the operation in the background, the progress and
+// the helm log lines are published to the returned topic. They're retained,
+// the operation runs before the client subscribes and the last progress is
+// replayed to it.
+func (r *Route) startHelmOperation(c *gin.Context, server, namespace, name, operation string, payload gin.H, run func(context.Context, *action.Configuration) (int, error)) {
+	username := c.GetString("username")
+	topic := fmt.Sprintf("helm_%s_%s_%s", server, namespace, name)
+	progress := model.HelmProgress{Operation: operation, Namespace: namespace, Name: name, Status: model.HelmRunning}
+	publish := func(format string, v ...any) {
+		p := progress
+		p.Message = fmt.Sprintf(format, v...)
+		r.hub.PublishRetained(username, topic, p)
+	}
+	ctx := context.WithoutCancel(c.Request.Context())
+	actionConfig, err := r.helmConfig(ctx, server, namespace, publish)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	// the request is over before the operation, the audit needs the user
+	cc := c.Copy()
+	go func() {
+		revision, err := run(ctx, actionConfig)
+		payload["revision"] = revision
+		r.record(cc, audit.Entry{
+			Cluster:   server,
+			Namespace: namespace,
+			Kind:      "HelmRelease",
+			Name:      name,
+			Operation: rbac.Helm + " " + operation,
+			Payload:   payload,
+		}, err)
+		progress.Revision = revision
+		progress.Status = model.HelmDone
+		if err != nil {
+			slog.Error("helm "+operation, "release", name, "ns", namespace, "err", err.Error())
+			progress.Status, progress.Message = model.HelmFailed, err.Error()
+		}
+		r.hub.PublishRetained(username, topic, progress)
+	}()
+	c.JSON(http.StatusOK, r.subscription(c, topic))
+}
+
+// helmTimeout of the operations waiting for the resources, 5 minutes by
+// default.
+func helmTimeout(seconds int) time.Duration {
+	if seconds == 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
 }
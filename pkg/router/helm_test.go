@@ -0,0 +1,127 @@
+package router
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"teleskopio/pkg/model"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/repo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLocalChart(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := chartutil.Create("web", dir); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := loader.Load(filepath.Join(dir, "web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a local repository serving the archive of the chart
+	repoDir := filepath.Join(dir, "repo")
+	if err := os.Mkdir(repoDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := chartutil.Save(ch, repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := repo.NewIndexFile()
+	if err := index.MustAdd(ch.Metadata, filepath.Base(archive), "", "sha256:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.MustAdd(ch.Metadata, "remote", "https://charts.example.com", "sha256:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.WriteFile(filepath.Join(repoDir, indexFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := localChart(dir, "web", ""); err != nil {
+		t.Fatalf("chart directory: %v", err)
+	}
+	if _, err := localChart(repoDir, "web", ch.Metadata.Version); err != nil {
+		t.Fatalf("indexed chart: %v", err)
+	}
+	if _, err := localChart(dir, "../web", ""); err == nil {
+		t.Fatal("a chart outside of the directory must be rejected")
+	}
+	if _, err := localChart(dir, "missing", ""); err == nil {
+		t.Fatal("a missing chart must fail")
+	}
+
+	charts, err := localCharts(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the archive and its index entry, the remote one is skipped
+	if len(charts) != 2 || charts[0].Name != "web" || charts[1].Name != "web" {
+		t.Fatalf("unexpected charts %+v", charts)
+	}
+}
+
+func TestHelmDiff(t *testing.T) {
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "web", Version: "1.0.0"},
+		Values:   map[string]any{"replicas": 1, "image": "web:1"},
+	}
+	deployment := func(image string) string {
+		return "---\n# Source: web/templates/deployment.yaml\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  image: " + image + "\n"
+	}
+	service := "---\n# Source: web/templates/service.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+	config := "---\n# Source: web/templates/config.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n"
+	from := &release.Release{Version: 1, Chart: ch, Manifest: deployment("web:1") + service}
+	to := &release.Release{Version: 2, Chart: ch, Config: map[string]any{"image": "web:2"}, Manifest: deployment("web:2") + config}
+
+	diff, err := helmDiff(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff.Values, "+image: web:2") {
+		t.Fatalf("unexpected values diff\n%s", diff.Values)
+	}
+	if !strings.Contains(diff.ComputedValues, "-image: web:1") || !strings.Contains(diff.ComputedValues, "+image: web:2") {
+		t.Fatalf("unexpected computed values diff\n%s", diff.ComputedValues)
+	}
+	changes := map[string]string{}
+	for _, o := range diff.Objects {
+		changes[o.Kind] = o.Change
+	}
+	want := map[string]string{"Deployment": model.ObjectChanged, "ConfigMap": model.ObjectAdded, "Service": model.ObjectRemoved}
+	if !maps.Equal(changes, want) {
+		t.Fatalf("expected %v, got %v", want, changes)
+	}
+}
+
+func TestLatestReleaseSecrets(t *testing.T) {
+	secret := func(ns, name, version string) unstructured.Unstructured {
+		sec := unstructured.Unstructured{}
+		sec.SetNamespace(ns)
+		sec.SetName("sh.helm.release.v1." + name + ".v" + version)
+		sec.SetLabels(map[string]string{"name": name, "version": version})
+		return sec
+	}
+	got := latestReleaseSecrets([]unstructured.Unstructured{
+		secret("b", "web", "1"),
+		secret("a", "web", "10"),
+		secret("a", "web", "9"),
+		secret("a", "db", "2"),
+	})
+	var names []string
+	for _, sec := range got {
+		names = append(names, sec.GetNamespace()+"/"+sec.GetName())
+	}
+	want := "a/sh.helm.release.v1.db.v2,a/sh.helm.release.v1.web.v10,b/sh.helm.release.v1.web.v1"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(names, ","))
+	}
+}
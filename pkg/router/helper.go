@@ -9,6 +9,7 @@ import (
 	"io"
 
 	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func decodeHelmRelease(data []byte) (release.Release, error) {
@@ -33,3 +34,17 @@ func decodeHelmRelease(data []byte) (release.Release, error) {
 	}
 	return release, nil
 }
+
+// secretRelease decodes the release stored in a helm secret of the informer,
+// the secret data is base64 encoded once more than in a typed secret.
+func secretRelease(sec *unstructured.Unstructured) (release.Release, error) {
+	data, _, err := unstructured.NestedString(sec.Object, "data", "release")
+	if err != nil {
+		return release.Release{}, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return release.Release{}, fmt.Errorf("decoding secret data: %w", err)
+	}
+	return decodeHelmRelease(raw)
+}
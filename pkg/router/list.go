@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +16,9 @@ func (r *Route) ListCustomResourceDefinitions(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Kind: "CustomResourceDefinition", Verb: rbac.List}) {
+		return
+	}
 	crdList, err := r.kapi.ListCustomResourceDefinitions(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
@@ -29,6 +33,9 @@ func (r *Route) ListResources(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowedCluster(c, req.Server) {
+		return
+	}
 	result, err := r.kapi.ListResources(req.Server)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
@@ -37,12 +44,30 @@ func (r *Route) ListResources(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// InvalidateDiscovery drops the cached kinds of the cluster, the CRDs may
+// have changed outside of teleskopio.
+func (r *Route) InvalidateDiscovery(c *gin.Context) {
+	var req model.PayloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowedCluster(c, req.Server) {
+		return
+	}
+	r.kapi.InvalidateDiscovery(req.Server)
+	c.JSON(http.StatusOK, gin.H{"success": ""})
+}
+
 func (r *Route) ListDynamicResource(c *gin.Context) {
 	var req model.ListRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.APIResource.Kind, Verb: rbac.List}) {
+		return
+	}
 	items, continueToken, resourceVersion, err := r.kapi.ListDynamicResource(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
@@ -58,6 +83,9 @@ func (r *Route) ListEventsDynamicResource(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.APIResource.Kind, Verb: rbac.List}) {
+		return
+	}
 	items, continueToken, resourceVersion, err := r.kapi.ListEventsDynamicResource(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
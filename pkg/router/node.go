@@ -1,12 +1,13 @@
 package router
 
 import (
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 
+	"teleskopio/pkg/audit"
 	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
 
 	"github.com/gin-gonic/gin"
 
@@ -20,7 +21,16 @@ func (r *Route) NodeOperation(c *gin.Context) {
 		return
 	}
 
-	if err := r.kapi.NodeOperation(c.Request.Context(), req); err != nil {
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Kind: "Node", Verb: rbac.Update}) {
+		return
+	}
+	operation := "uncordon"
+	if req.Cordon {
+		operation = "cordon"
+	}
+	err := r.kapi.NodeOperation(c.Request.Context(), req)
+	r.record(c, audit.Entry{Cluster: req.Server, Kind: "Node", Name: req.Name, Operation: operation}, err)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
@@ -28,22 +38,56 @@ func (r *Route) NodeOperation(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": ""})
 }
 
+// WatchDrain hands out the topic of the evicted pods before the drain starts,
+// the drain itself responds once it's over.
+func (r *Route) WatchDrain(c *gin.Context) {
+	var req model.NodeDrain
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Kind: "Node", Verb: rbac.Drain}) {
+		return
+	}
+	c.JSON(http.StatusOK, r.subscription(c, drainTopic(req)))
+}
+
+func drainTopic(req model.NodeDrain) string {
+	return fmt.Sprintf("drain_%s_%s_%s", req.Server, req.ResourceName, req.ResourceUID)
+}
+
 func (r *Route) NodeDrain(c *gin.Context) {
 	var req model.NodeDrain
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Kind: "Node", Verb: rbac.Drain}) {
+		return
+	}
+	username := c.GetString("username")
 	onDelete := func(pod *corev1.Pod, usingEviction bool) {
 		slog.Debug("Deleted/Evicted pod", "ns", pod.Namespace, "pod", pod.Name, "eviction", usingEviction)
-		payload, _ := json.Marshal(map[string]interface{}{
-			"event":   fmt.Sprintf("drain_%s_%s", req.ResourceName, req.ResourceUID),
-			"payload": map[string]any{"pod": pod.Name, "ns": pod.Namespace, "eviction": usingEviction},
-		})
-		r.hub.Broadcast(payload)
+		r.hub.PublishUser(
+			username,
+			drainTopic(req),
+			map[string]any{"pod": pod.Name, "ns": pod.Namespace, "eviction": usingEviction},
+		)
 	}
 
 	node, err := r.kapi.NodeDrain(c.Request.Context(), req, onDelete)
+	r.record(c, audit.Entry{
+		Cluster:   req.Server,
+		Kind:      "Node",
+		Name:      req.ResourceName,
+		Operation: rbac.Drain,
+		Payload: gin.H{
+			"force":                  req.DrainForce,
+			"ignore_all_daemon_sets": req.IgnoreAllDaemonSets,
+			"delete_empty_dir_data":  req.DeleteEmptyDirData,
+			"timeout":                req.DrainTimeout,
+		},
+	}, err)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
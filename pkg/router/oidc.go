@@ -0,0 +1,86 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"teleskopio/pkg/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+const oidcCookie = "teleskopio_oidc"
+
+func (r *Route) OIDCEnabled(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"message": r.oidc.Enabled()})
+}
+
+func (r *Route) OIDCLogin(c *gin.Context) {
+	if !r.oidc.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"message": "oidc is disabled"})
+		return
+	}
+	state, nonce := randomString(), randomString()
+	authURL, err := r.oidc.AuthCodeURL(c.Request.Context(), state, nonce)
+	if err != nil {
+		slog.Error("oidc login", "err", err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"message": err.Error()})
+		return
+	}
+	r.setOIDCCookie(c, state+":"+nonce, 600)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback mints the same JWT as Login and hands it over to the frontend
+// in the url fragment, so it never reaches the server logs.
+func (r *Route) OIDCCallback(c *gin.Context) {
+	if !r.oidc.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"message": "oidc is disabled"})
+		return
+	}
+	cookie, err := c.Cookie(oidcCookie)
+	r.setOIDCCookie(c, "", -1)
+	state, nonce, found := strings.Cut(cookie, ":")
+	if err != nil || !found || state != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid oidc state"})
+		return
+	}
+	if errMsg := c.Query("error"); errMsg != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": errMsg})
+		return
+	}
+	identity, err := r.oidc.Exchange(c.Request.Context(), c.Query("code"), nonce)
+	if errors.Is(err, oidc.ErrNoRole) || errors.Is(err, oidc.ErrReservedName) {
+		slog.Info("oidc user without role", "user", identity.Username, "groups", identity.Groups)
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("oidc callback", "err", err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
+		return
+	}
+	t, err := r.issueToken(identity.Username, identity.Role, identity.Groups)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
+		return
+	}
+	c.Redirect(http.StatusFound, "/#token="+url.QueryEscape(t))
+}
+
+func (r *Route) setOIDCCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, value, maxAge, "/api/oidc", "", r.cfg.Get().Protocol == "https", true)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	//nolint:errcheck
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,15 +1,19 @@
 package router
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
-	"time"
+	"strings"
 
+	"teleskopio/pkg/logfilter"
 	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
 
 	"github.com/gin-gonic/gin"
 	corev1 "k8s.io/api/core/v1"
@@ -22,117 +26,198 @@ func (r *Route) GetPodLogs(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	podLogs, err := r.kapi.GetPodLogsReader(c.Request.Context(), req, &corev1.PodLogOptions{
-		TailLines: req.TailLines,
-		Container: req.Container,
-	})
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: "Pod", Verb: rbac.Get}) {
 		return
 	}
-	defer podLogs.Close()
-
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, podLogs)
+	var grep *logfilter.Grep
+	if req.Filter != nil {
+		filter, err := logfilter.New(*req.Filter, req.Timestamps)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		grep = filter.Grep()
+	}
+	podLogs, err := r.kapi.GetPodLogsReader(c.Request.Context(), req, podLogOptions(req))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	defer podLogs.Close()
+
+	reader := bufio.NewReader(podLogs)
 	lines := []string{}
 	for {
-		line, err := buf.ReadString('\n')
-		if err == io.EOF {
+		line, err := reader.ReadString('\n')
+		switch {
+		case line == "":
+		case grep == nil:
+			lines = append(lines, line)
+		default:
+			grep.Push(strings.TrimSuffix(line, "\n"), func(l logfilter.Line) {
+				// the separator of grep between the groups of context
+				if l.Gap {
+					lines = append(lines, "--\n")
+				}
+				lines = append(lines, l.Text+"\n")
+			})
+		}
+		if errors.Is(err, io.EOF) {
 			break
 		}
-		lines = append(lines, line)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
 	}
 	c.JSON(http.StatusOK, lines)
 }
 
-func (r *Route) StreamPodLogs(c *gin.Context) {
+// DownloadPodLogs writes the logs of the container as they are read, plain
+// or gzipped, so the whole log is never held in memory.
+func (r *Route) DownloadPodLogs(c *gin.Context) {
 	var req model.PodLogRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindQuery(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	timeNow := metav1.NewTime(time.Now())
-	podLogOptions := &corev1.PodLogOptions{
-		Follow:    true,
-		Container: req.Container,
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: "Pod", Verb: rbac.Get}) {
+		return
 	}
-	podLogOptions.SinceTime = &timeNow
-	podLogs, err := r.kapi.GetPodLogsReader(c.Request.Context(), req, podLogOptions)
+	podLogs, err := r.kapi.GetPodLogsReader(c.Request.Context(), req, podLogOptions(req))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	defer podLogs.Close()
 
-	// TODO might be a collision with another server
-	podLogsKey := fmt.Sprintf("pod_log_line_%s_%s", req.Name, req.Namespace)
-	if _, ok := r.podLogsWatchers[podLogsKey]; ok {
-		c.JSON(http.StatusOK, gin.H{"success": ""})
-		return
+	filename := req.Name + "_" + req.Container
+	if req.Previous {
+		filename += "_previous"
 	}
-	r.podLogsWatchers[podLogsKey] = make(chan bool)
-	stopAndClean := func() {
-		slog.Debug("stop pod logs stream", "pod", podLogsKey)
-		podlogsChan := r.podLogsWatchers[podLogsKey]
-		close(podlogsChan)
-		delete(r.podLogsWatchers, podLogsKey)
-		podLogs.Close()
-	}
-	cancel := func() bool {
-		select {
-		case <-r.podLogsWatchers[podLogsKey]:
-			return true
-		default:
-			return false
-		}
+	filename += ".log"
+	var w io.Writer = c.Writer
+	if req.Gzip {
+		filename += ".gz"
+		c.Header("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		w = gz
+	} else {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
 	}
-	go func() {
-		defer stopAndClean()
-		for cancel() {
-			buf := make([]byte, 2000)
-			numBytes, err := podLogs.Read(buf)
-			if err == io.EOF {
-				break
-			}
-			if numBytes == 0 {
-				time.Sleep(time.Second)
-				continue
-			}
-			if err != nil {
-				break
-			}
-			message := string(buf[:numBytes])
-			slog.Debug("log line", "line", message, "pod", podLogsKey)
-			payload, _ := json.Marshal(map[string]interface{}{
-				"event": podLogsKey,
-				"payload": map[string]interface{}{
-					"container": req.Container,
-					"pod":       req.Name,
-					"namespace": req.Namespace,
-					"line":      message,
-				},
-			})
-			r.hub.Broadcast(payload)
-		}
-	}()
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Status(http.StatusOK)
+	// the status is sent, a broken stream only truncates the file
+	if _, err := io.Copy(w, podLogs); err != nil {
+		slog.Error("download pod logs", "pod", req.Name, "container", req.Container, "err", err.Error())
+	}
+}
 
-	c.JSON(http.StatusOK, gin.H{"success": ""})
+func podLogOptions(req model.PodLogRequest) *corev1.PodLogOptions {
+	opts := &corev1.PodLogOptions{
+		Container:    req.Container,
+		TailLines:    req.TailLines,
+		Previous:     req.Previous,
+		Timestamps:   req.Timestamps,
+		SinceSeconds: req.SinceSeconds,
+		LimitBytes:   req.LimitBytes,
+	}
+	if req.SinceTime != nil {
+		opts.SinceTime = &metav1.Time{Time: *req.SinceTime}
+	}
+	return opts
+}
+
+// StreamPodLogs follows one container of the pod, it's StreamLogs with a pod
+// target.
+func (r *Route) StreamPodLogs(c *gin.Context) {
+	var req model.PodLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	r.streamLogs(c, podLogStream(req))
 }
 
 func (r *Route) StopStreamPodLogs(c *gin.Context) {
 	var req model.PodLogRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		slog.Error("parsing", "err", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	stream := podLogStream(req)
+	r.stopLogs(c, stream.Topic())
+}
+
+func podLogStream(req model.PodLogRequest) model.LogStreamRequest {
+	return model.LogStreamRequest{
+		Server:       req.Server,
+		Namespace:    req.Namespace,
+		Kind:         "Pod",
+		Name:         req.Name,
+		Container:    req.Container,
+		TailLines:    req.TailLines,
+		Timestamps:   req.Timestamps,
+		SinceSeconds: req.SinceSeconds,
+		SinceTime:    req.SinceTime,
+		Filter:       req.Filter,
+	}
+}
+
+// StreamLogs follows the logs of the pods selected by a label selector or a
+// workload, the lines are published to the returned topic until the stream
+// is stopped.
+func (r *Route) StreamLogs(c *gin.Context) {
+	var req model.LogStreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	r.streamLogs(c, req)
+}
 
-	podLogsKey := fmt.Sprintf("pod_log_line_%s_%s", req.Name, req.Namespace)
+func (r *Route) StopLogs(c *gin.Context) {
+	var req model.LogTopic
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	r.stopLogs(c, req.Topic)
+}
 
-	r.podLogsWatchers[podLogsKey] <- true
+// streamLogs shares the stream of the topic between the users reading it
+// with the same cluster identity, the stream outlives the request and keeps
+// the identity of the user who started it.
+func (r *Route) streamLogs(c *gin.Context, req model.LogStreamRequest) {
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: "Pod", Verb: rbac.Get}) {
+		return
+	}
+	if req.Kind != "" && !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.Kind, Verb: rbac.Get}) {
+		return
+	}
+	topic := req.Topic()
+	ctx := context.WithoutCancel(c.Request.Context())
+	key := topic + "|" + r.kapi.Impersonated(ctx)
+	r.logStreams.acquire(ctx, key, topic, r.streamHolder(c), func(ctx context.Context, users func() []string) {
+		err := r.kapi.StreamLogs(ctx, req, func(line model.LogLine) {
+			// only the users holding the stream get the lines
+			for _, user := range users() {
+				r.hub.PublishUser(user, topic, line)
+			}
+		})
+		if err != nil {
+			slog.Error("logs stream", "topic", topic, "err", err.Error())
+		}
+	})
+	c.JSON(http.StatusOK, r.subscription(c, topic))
+}
 
+func (r *Route) stopLogs(c *gin.Context, topic string) {
+	r.logStreams.release(topic, r.streamHolder(c))
 	c.JSON(http.StatusOK, gin.H{"success": ""})
 }
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"teleskopio/pkg/config"
+	"teleskopio/pkg/kubeapi"
+	"teleskopio/pkg/model"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestPodLogStreamFilter(t *testing.T) {
+	pods := corev1.PodList{
+		TypeMeta: metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"},
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items: []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", ResourceVersion: "1"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "app",
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}}},
+		}},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/default/pods", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			// no events, the watch lasts as long as the stream
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		//nolint:errcheck
+		json.NewEncoder(w).Encode(pods)
+	})
+	mux.HandleFunc("/api/v1/namespaces/default/pods/api/log", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "level=info ready\nlevel=error boom\n")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	typed, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle := time.Minute
+	kapi := kubeapi.New(
+		&config.Config{Kube: config.Kube{Cache: config.Cache{IdleTimeout: &idle}}},
+		[]*config.Cluster{{Name: "kind", Typed: typed}},
+	)
+
+	stream := podLogStream(model.PodLogRequest{
+		Server:    "kind",
+		Namespace: "default",
+		Name:      "api",
+		Filter:    &model.LogFilter{Include: "boom"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lines := make(chan model.LogLine, 2)
+	go func() {
+		//nolint:errcheck
+		kapi.StreamLogs(ctx, stream, func(l model.LogLine) { lines <- l })
+	}()
+	// the lines come in order, an unfiltered stream sends ready first
+	select {
+	case l := <-lines:
+		if l.Line != "level=error boom" {
+			t.Fatalf("expected the filtered line, got %q", l.Line)
+		}
+	case <-ctx.Done():
+		t.Fatal("the matching line was not streamed")
+	}
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"teleskopio/pkg/audit"
+	"teleskopio/pkg/kubeapi"
+	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// StartPortForward opens a forward owned by the user, it's closed when the
+// token of the session expires.
+func (r *Route) StartPortForward(c *gin.Context) {
+	var req model.PortForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.Kind, Verb: rbac.PortForward}) {
+		return
+	}
+	var expires time.Time
+	if claims, ok := model.ClaimsFromContext(c.Request.Context()); ok && claims.ExpiresAt != nil {
+		expires = claims.ExpiresAt.Time
+	}
+	fwd, err := r.kapi.StartPortForward(c.Request.Context(), req, c.GetString("username"), r.session(c), expires)
+	r.record(c, audit.Entry{
+		Cluster:   req.Server,
+		Namespace: req.Namespace,
+		Kind:      req.Kind,
+		Name:      req.Name,
+		Operation: rbac.PortForward,
+		Payload:   fwd,
+	}, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, fwd)
+}
+
+func (r *Route) ListPortForwards(c *gin.Context) {
+	c.JSON(http.StatusOK, r.kapi.PortForwards(c.GetString("username")))
+}
+
+func (r *Route) StopPortForward(c *gin.Context) {
+	var req model.PortForwardID
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	fwd, err := r.kapi.StopPortForward(req.ID, c.GetString("username"))
+	if errors.Is(err, kubeapi.ErrPortForwardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	r.record(c, audit.Entry{
+		Cluster:   fwd.Server,
+		Namespace: fwd.Namespace,
+		Kind:      fwd.Kind,
+		Name:      fwd.Name,
+		Operation: "stop " + rbac.PortForward,
+		Payload:   fwd,
+	}, err)
+	c.JSON(http.StatusOK, gin.H{"success": ""})
+}
+
+// TunnelPortForward carries one connection to the forward over the
+// websocket, the data goes in binary messages both ways.
+func (r *Route) TunnelPortForward(c *gin.Context) {
+	var req model.PortForwardID
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	conn, err := r.kapi.DialPortForward(c.Request.Context(), req.ID, c.GetString("username"))
+	if errors.Is(err, kubeapi.ErrPortForwardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"message": err.Error()})
+		return
+	}
+	defer conn.Close()
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.Error("port forward upgrade", "err", err.Error())
+		return
+	}
+	defer ws.Close()
+
+	go func() {
+		defer conn.Close()
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, err := conn.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				slog.Debug("port forward tunnel", "id", req.ID, "err", err.Error())
+			}
+			return
+		}
+	}
+}
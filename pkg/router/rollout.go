@@ -0,0 +1,135 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"teleskopio/pkg/audit"
+	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rolloutStatusTimeout bounds the status watchers of the rollouts that never
+// finish.
+const rolloutStatusTimeout = 15 * time.Minute
+
+func (r *Route) RolloutRestart(c *gin.Context) {
+	r.rolloutOperation(c, "restart", func(ctx context.Context, req model.RolloutRequest) (string, error) {
+		return "", r.kapi.RolloutRestart(ctx, req)
+	})
+}
+
+func (r *Route) RolloutPause(c *gin.Context) {
+	r.rolloutOperation(c, "pause", func(ctx context.Context, req model.RolloutRequest) (string, error) {
+		return "", r.kapi.RolloutPause(ctx, req, true)
+	})
+}
+
+func (r *Route) RolloutResume(c *gin.Context) {
+	r.rolloutOperation(c, "resume", func(ctx context.Context, req model.RolloutRequest) (string, error) {
+		return "", r.kapi.RolloutPause(ctx, req, false)
+	})
+}
+
+func (r *Route) RolloutUndo(c *gin.Context) {
+	r.rolloutOperation(c, "undo", r.kapi.RolloutUndo)
+}
+
+func (r *Route) rolloutOperation(c *gin.Context, operation string, fn func(ctx context.Context, req model.RolloutRequest) (string, error)) {
+	var req model.RolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.Kind, Verb: rbac.Rollout}) {
+		return
+	}
+	message, err := fn(c.Request.Context(), req)
+	r.record(c, audit.Entry{
+		Cluster:   req.Server,
+		Namespace: req.Namespace,
+		Kind:      req.Kind,
+		Name:      req.Name,
+		Operation: rbac.Rollout + " " + operation,
+		Payload:   gin.H{"revision": req.Revision},
+	}, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": message})
+}
+
+func (r *Route) RolloutHistory(c *gin.Context) {
+	var req model.RolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.Kind, Verb: rbac.Get}) {
+		return
+	}
+	revisions, err := r.kapi.RolloutHistory(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// RolloutStatus responds the current rollout status, the next ones are
+// published to the returned topic until the rollout is done. One watcher runs
+// per workload and cluster identity.
+func (r *Route) RolloutStatus(c *gin.Context) {
+	var req model.RolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.Kind, Verb: rbac.Watch}) {
+		return
+	}
+	status, err := r.kapi.CurrentRolloutStatus(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	sub := r.subscription(c, fmt.Sprintf("rollout_status_%s_%s_%s_%s", req.Server, req.Namespace, req.Kind, req.Name))
+	if !status.Done {
+		r.watchRollout(c, req, sub.Topic)
+	}
+	c.JSON(http.StatusOK, gin.H{"topic": sub.Topic, "token": sub.Token, "status": status})
+}
+
+// watchRollout starts the status watcher of the topic, it outlives the
+// request and keeps the identity of the user.
+func (r *Route) watchRollout(c *gin.Context, req model.RolloutRequest, topic string) {
+	ctx := context.WithoutCancel(c.Request.Context())
+	key := topic + "|" + r.kapi.Impersonated(ctx)
+	r.rollouts.acquire(ctx, key, topic, r.streamHolder(c), func(ctx context.Context, users func() []string) {
+		ctx, cancel := context.WithTimeout(ctx, rolloutStatusTimeout)
+		defer cancel()
+		// retained, the first statuses come before the users subscribe
+		publish := func(status model.RolloutStatus) {
+			for _, user := range users() {
+				r.hub.PublishRetained(user, topic, status)
+			}
+		}
+		err := r.kapi.RolloutStatus(ctx, req, publish)
+		// a watcher stopped for lack of subscribers has nobody to tell
+		if err != nil && !errors.Is(ctx.Err(), context.Canceled) {
+			slog.Debug("rollout status", "topic", topic, "err", err.Error())
+			publish(model.RolloutStatus{Done: true, Error: err.Error()})
+		}
+	})
+}
@@ -1,56 +1,112 @@
 package router
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"teleskopio/pkg/audit"
 	"teleskopio/pkg/config"
-	"teleskopio/pkg/genericmap"
 	"teleskopio/pkg/kubeapi"
 	"teleskopio/pkg/model"
+	"teleskopio/pkg/oidc"
+	"teleskopio/pkg/rbac"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 
 	"golang.org/x/crypto/bcrypt"
 
-	w "k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/informers"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	webSocket "teleskopio/pkg/socket"
 )
 
 type Route struct {
-	cfg   *config.Config
-	kapi  *kubeapi.KubeAPI
-	users *config.Users
-	hub   *webSocket.Hub
-	// TODO
-	// Add mutex
-	watchers        *genericmap.Map[string, w.Interface]
-	helmWathers     *genericmap.Map[string, informers.SharedInformerFactory]
-	podLogsWatchers map[string]chan (bool)
-}
-
-func New(hub *webSocket.Hub, cfg *config.Config, kapi *kubeapi.KubeAPI, users *config.Users) (Route, error) {
-	watchersMap := &genericmap.Map[string, w.Interface]{}
-	helmWatchersMap := &genericmap.Map[string, informers.SharedInformerFactory]{}
+	cfg        *config.Current
+	kapi       *kubeapi.KubeAPI
+	hub        *webSocket.Hub
+	oidc       *oidc.Provider
+	rbac       *rbac.Authorizer
+	audit      *audit.Logger
+	store      *config.ClusterStore
+	logStreams *sharedStreams
+	rollouts   *sharedStreams
+}
+
+// New - users, roles, MCP and JWT settings are read from the current config,
+// OIDC and audit settings are only read here.
+func New(hub *webSocket.Hub, cfg *config.Current, kapi *kubeapi.KubeAPI, store *config.ClusterStore) (Route, error) {
+	auditLogger, err := audit.New(cfg.Get().Audit)
+	if err != nil {
+		return Route{}, err
+	}
 	r := Route{
-		cfg:             cfg,
-		kapi:            kapi,
-		users:           users,
-		hub:             hub,
-		watchers:        watchersMap,
-		helmWathers:     helmWatchersMap,
-		podLogsWatchers: make(map[string]chan bool),
+		cfg:        cfg,
+		kapi:       kapi,
+		hub:        hub,
+		oidc:       oidc.New(cfg.Get().OIDC),
+		rbac:       rbac.New(cfg, kapi.Address),
+		audit:      auditLogger,
+		store:      store,
+		logStreams: newSharedStreams("logs stream"),
+		rollouts:   newSharedStreams("rollout status"),
 	}
+	hub.Observe(kapi.Informers().SetSubscribers)
+	hub.Observe(r.logStreams.setSubscribers)
+	hub.Observe(r.rollouts.setSubscribers)
 	return r, nil // TODO
 }
 
 func (r *Route) LookupConfigs(c *gin.Context) {
-	c.JSON(http.StatusOK, r.kapi.GetClusters())
+	clusters := slices.DeleteFunc(r.kapi.GetClusters(), func(cl model.Cluster) bool {
+		return !r.rbac.AllowedCluster(c.GetString("role"), cl.Server)
+	})
+	c.JSON(http.StatusOK, clusters)
+}
+
+// allowed checks the request against the role of the user, forbidden
+// requests are answered here.
+func (r *Route) allowed(c *gin.Context, req rbac.Request) bool {
+	req.Role = c.GetString("role")
+	if r.rbac.Allowed(req) {
+		return true
+	}
+	slog.Info("access denied", "role", req.Role, "verb", req.Verb, "kind", req.Kind, "namespace", req.Namespace, "server", req.Cluster)
+	err := fmt.Errorf("%w, %s %s is not allowed", rbac.ErrForbidden, req.Verb, req.Kind)
+	if !slices.Contains([]string{rbac.Get, rbac.List, rbac.Watch}, req.Verb) {
+		r.record(c, audit.Entry{Cluster: req.Cluster, Namespace: req.Namespace, Kind: req.Kind, Operation: req.Verb}, err)
+	}
+	c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	return false
+}
+
+// objectAuthorizer checks every object of the manifest before it's applied,
+// all the verbs must be allowed.
+func (r *Route) objectAuthorizer(c *gin.Context, server string, verbs ...string) func(obj *unstructured.Unstructured) error {
+	role := c.GetString("role")
+	return func(obj *unstructured.Unstructured) error {
+		for _, verb := range verbs {
+			req := rbac.Request{Role: role, Cluster: server, Namespace: obj.GetNamespace(), Kind: obj.GetKind(), Verb: verb}
+			if !r.rbac.Allowed(req) {
+				return fmt.Errorf("%w, %s %s %s/%s is not allowed", rbac.ErrForbidden, verb, obj.GetKind(), obj.GetNamespace(), obj.GetName())
+			}
+		}
+		return nil
+	}
+}
+
+func (r *Route) allowedCluster(c *gin.Context, server string) bool {
+	if r.rbac.AllowedCluster(c.GetString("role"), server) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"message": "access denied"})
+	return false
 }
 
 func (r *Route) GetVersion(c *gin.Context) {
@@ -59,6 +115,9 @@ func (r *Route) GetVersion(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowedCluster(c, req.Server) {
+		return
+	}
 	ver, err := r.kapi.GetVersion(req)
 	if err != nil {
 		slog.Error("client", "err", err.Error(), "req", req)
@@ -75,6 +134,9 @@ func (r *Route) GetDynamicResource(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.APIResource.Kind, Verb: rbac.Get}) {
+		return
+	}
 	res, err := r.kapi.GetDynamicResource(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
@@ -84,33 +146,108 @@ func (r *Route) GetDynamicResource(c *gin.Context) {
 }
 
 func (r *Route) CreateKubeResource(c *gin.Context) {
+	r.writeKubeResource(c, kubeapi.OpCreate)
+}
+
+func (r *Route) UpdateKubeResource(c *gin.Context) {
+	r.writeKubeResource(c, kubeapi.OpUpdate)
+}
+
+func (r *Route) ApplyKubeResource(c *gin.Context) {
+	r.writeKubeResource(c, kubeapi.OpApply)
+}
+
+// writeKubeResource answers with the result of every object of the manifest,
+// the message lists the failed ones. Dry runs are not audited as nothing
+// changes.
+func (r *Route) writeKubeResource(c *gin.Context, op string) {
 	var req model.ObjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	created, err := r.kapi.CreateOrUpdateKubeResource(c.Request.Context(), req, "create")
+	results, err := r.kapi.CreateOrUpdateKubeResource(c.Request.Context(), req, op, r.objectAuthorizer(c, req.Server, opVerbs(op)...))
 	if err != nil {
+		if !req.DryRun {
+			r.record(c, audit.Entry{Cluster: req.Server, Operation: op, Payload: manifestPayload(req.Yaml, nil)}, err)
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	status := http.StatusOK
+	failed := []string{}
+	payload := manifestPayload(req.Yaml, results)
+	for _, res := range results {
+		if res.Status == model.ObjectSkipped {
+			continue
+		}
+		if !req.DryRun {
+			r.record(c, audit.Entry{
+				Cluster:   req.Server,
+				Namespace: res.Namespace,
+				Kind:      res.Kind,
+				Name:      res.Name,
+				Operation: op,
+				Payload:   payload,
+			}, res.Err)
+		}
+		if res.Err == nil {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%s %s: %s", res.Kind, res.Name, res.Error))
+		switch {
+		case errors.Is(res.Err, rbac.ErrForbidden):
+			status = http.StatusForbidden
+		case status == http.StatusOK:
+			status = http.StatusBadRequest
+		}
+	}
+	resp := gin.H{"items": results}
+	if len(failed) > 0 {
+		resp["message"] = strings.Join(failed, "; ")
+	}
+	c.JSON(status, resp)
+}
 
-	c.YAML(http.StatusOK, created)
+// manifestPayload records the manifest by its digest along with the objects
+// it holds, the skipped ones of an atomic write included.
+func manifestPayload(manifest string, results []model.ObjectResult) gin.H {
+	objects := make([]gin.H, 0, len(results))
+	for _, res := range results {
+		objects = append(objects, gin.H{"kind": res.Kind, "namespace": res.Namespace, "name": res.Name})
+	}
+	return gin.H{"manifest": audit.Digest(manifest), "objects": objects}
 }
 
-func (r *Route) UpdateKubeResource(c *gin.Context) {
+// DiffKubeResource previews the operation, apply by default.
+func (r *Route) DiffKubeResource(c *gin.Context) {
 	var req model.ObjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	updated, err := r.kapi.CreateOrUpdateKubeResource(c.Request.Context(), req, "update")
+	op := cmp.Or(req.Operation, kubeapi.OpApply)
+	diff, err := r.kapi.DiffKubeResource(c.Request.Context(), req, op, r.objectAuthorizer(c, req.Server, opVerbs(op)...))
+	if errors.Is(err, rbac.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, diff)
+}
 
-	c.YAML(http.StatusOK, updated)
+// opVerbs - apply creates the object when it's missing, so it needs both.
+func opVerbs(op string) []string {
+	switch op {
+	case kubeapi.OpCreate:
+		return []string{rbac.Create}
+	case kubeapi.OpApply:
+		return []string{rbac.Create, rbac.Update}
+	}
+	return []string{rbac.Update}
 }
 
 func (r *Route) DeleteDynamicResources(c *gin.Context) {
@@ -119,7 +256,26 @@ func (r *Route) DeleteDynamicResources(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	if err := r.kapi.DeleteDynamicResources(c.Request.Context(), req); err != nil {
+	for _, res := range req.Resources {
+		ns := res.Namespace
+		if !req.APIResource.Namespaced {
+			ns = ""
+		}
+		if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: ns, Kind: req.APIResource.Kind, Verb: rbac.Delete}) {
+			return
+		}
+	}
+	err := r.kapi.DeleteDynamicResources(c.Request.Context(), req)
+	for _, res := range req.Resources {
+		r.record(c, audit.Entry{
+			Cluster:   req.Server,
+			Namespace: res.Namespace,
+			Kind:      req.APIResource.Kind,
+			Name:      res.Name,
+			Operation: rbac.Delete,
+		}, err)
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
@@ -134,7 +290,19 @@ func (r *Route) ScaleResource(c *gin.Context) {
 		return
 	}
 
-	if err := r.kapi.ScaleResource(c.Request.Context(), req); err != nil {
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.APIResource.Kind, Verb: rbac.Scale}) {
+		return
+	}
+	err := r.kapi.ScaleResource(c.Request.Context(), req)
+	r.record(c, audit.Entry{
+		Cluster:   req.Server,
+		Namespace: req.Namespace,
+		Kind:      req.APIResource.Kind,
+		Name:      req.Name,
+		Operation: rbac.Scale,
+		Payload:   gin.H{"replicas": req.Replicas},
+	}, err)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
@@ -148,7 +316,18 @@ func (r *Route) TriggerCronjob(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: "CronJob", Verb: rbac.Trigger}) {
+		return
+	}
 	jobName, err := r.kapi.TriggerCronjob(c.Request.Context(), req)
+	r.record(c, audit.Entry{
+		Cluster:   req.Server,
+		Namespace: req.Namespace,
+		Kind:      "CronJob",
+		Name:      req.Name,
+		Operation: rbac.Trigger,
+		Payload:   gin.H{"job": jobName},
+	}, err)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
@@ -157,33 +336,6 @@ func (r *Route) TriggerCronjob(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": jobName})
 }
 
-// TODO this cleanup routine might cleanup watcher related to other user?
-func (r *Route) CleanUp(c *gin.Context) {
-	var req model.PayloadRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
-		return
-	}
-	if err := req.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
-		return
-	}
-	r.watchers.Range(func(k string, v w.Interface) bool {
-		if strings.Contains(k, req.Server) {
-			slog.Debug("stop watcher", "k", k)
-			v.Stop()
-			r.watchers.Delete(k)
-		}
-		return true
-	})
-	r.helmWathers.Range(func(k string, _ informers.SharedInformerFactory) bool {
-		// TODO
-		slog.Debug("helm watcher", "k", k)
-		return true
-	})
-	c.JSON(http.StatusOK, gin.H{"message": "cleanup"})
-}
-
 func (r *Route) Login(c *gin.Context) {
 	var req model.Creds
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -196,26 +348,56 @@ func (r *Route) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	u, ok := r.users.Users[req.Username]
+	u, ok := r.cfg.Users().Users[req.Username]
 	if !ok || bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password)) != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
 		return
 	}
 
-	exp := time.Now().Add(*r.cfg.JWTTokenExpire)
+	t, err := r.issueToken(u.Username, u.Role, u.Groups)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": t})
+}
+
+func (r *Route) issueToken(username, role string, groups []string) (string, error) {
+	cfg := r.cfg.Get()
+	exp := time.Now().Add(*cfg.JWTTokenExpire)
 	claims := &model.Claims{
-		Username: u.Username,
-		Role:     u.Role,
+		Username: username,
+		Role:     role,
+		Groups:   groups,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        randomString(),
 			ExpiresAt: jwt.NewNumericDate(exp),
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString([]byte(r.cfg.JWTKey))
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "invalid credentials"})
-		return
+	return token.SignedString([]byte(cfg.JWTKey))
+}
+
+// Logout ends the session on the server side, the port forwards and the
+// log streams started in the session are stopped. The other sessions of the
+// user keep theirs.
+func (r *Route) Logout(c *gin.Context) {
+	r.kapi.StopSessionPortForwards(c.GetString("username"), r.session(c))
+	r.logStreams.releaseSession(r.streamHolder(c))
+	r.rollouts.releaseSession(r.streamHolder(c))
+	c.JSON(http.StatusOK, gin.H{"success": ""})
+}
+
+// session is the ID of the token of the request, every login issues a new
+// one.
+func (r *Route) session(c *gin.Context) string {
+	if claims, ok := model.ClaimsFromContext(c.Request.Context()); ok {
+		return claims.ID
 	}
+	return ""
+}
 
-	c.JSON(http.StatusOK, gin.H{"token": t})
+func (r *Route) streamHolder(c *gin.Context) streamHolder {
+	return streamHolder{user: c.GetString("username"), session: r.session(c)}
 }
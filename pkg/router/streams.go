@@ -0,0 +1,157 @@
+package router
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// streamGrace is how long a stream waits for its first websocket subscriber
+// before it's stopped.
+const streamGrace = time.Minute
+
+// sharedStreams runs one stream per key publishing to a topic, like the log
+// streams or the rollout status watchers. The users reading the same topic
+// with the same cluster identity share the stream of the key. A stream holds
+// a reference per request of each session, it stops once the references are
+// released, the last websocket subscriber of the topic goes away or none
+// came within streamGrace.
+type sharedStreams struct {
+	// name of the streams in the logs
+	name string
+
+	mu      sync.Mutex
+	streams map[string]*sharedStream
+	// subscribers - the websocket subscribers by topic, fed by the hub
+	subscribers map[string]int
+}
+
+type sharedStream struct {
+	topic  string
+	cancel context.CancelFunc
+	// refs - the references held by every session
+	refs map[streamHolder]int
+}
+
+// streamHolder is the session of a user holding a stream, the token ID.
+type streamHolder struct {
+	user    string
+	session string
+}
+
+func newSharedStreams(name string) *sharedStreams {
+	return &sharedStreams{
+		name:        name,
+		streams:     map[string]*sharedStream{},
+		subscribers: map[string]int{},
+	}
+}
+
+// acquire references the stream of the key for the holder, run starts it when
+// it's not running yet. run gets the users to publish to and returns when the
+// stream ends.
+func (l *sharedStreams) acquire(ctx context.Context, key, topic string, holder streamHolder, run func(ctx context.Context, users func() []string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, running := l.streams[key]; running {
+		s.refs[holder]++
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &sharedStream{topic: topic, cancel: cancel, refs: map[streamHolder]int{holder: 1}}
+	l.streams[key] = s
+	go func() {
+		defer l.remove(key, s)
+		slog.Debug("start "+l.name, "topic", topic, "user", holder.user)
+		run(ctx, func() []string { return l.users(s) })
+		slog.Debug("stop "+l.name, "topic", topic)
+	}()
+	if l.subscribers[topic] == 0 {
+		time.AfterFunc(streamGrace, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.subscribers[topic] == 0 && l.streams[key] == s {
+				slog.Debug(l.name+" has no subscriber", "topic", topic)
+				l.stop(key, s)
+			}
+		})
+	}
+}
+
+// release drops a reference of the holder to the streams of the topic.
+func (l *sharedStreams) release(topic string, holder streamHolder) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, s := range l.streams {
+		if s.topic != topic || s.refs[holder] == 0 {
+			continue
+		}
+		if s.refs[holder]--; s.refs[holder] == 0 {
+			delete(s.refs, holder)
+		}
+		if len(s.refs) == 0 {
+			l.stop(key, s)
+		}
+	}
+}
+
+// releaseSession drops every reference of the holder, the session ended.
+// The other sessions of the user keep their streams.
+func (l *sharedStreams) releaseSession(holder streamHolder) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, s := range l.streams {
+		if _, held := s.refs[holder]; !held {
+			continue
+		}
+		delete(s.refs, holder)
+		if len(s.refs) == 0 {
+			l.stop(key, s)
+		}
+	}
+}
+
+// setSubscribers is the hub observer, the streams of a topic nobody listens
+// to anymore are stopped.
+func (l *sharedStreams) setSubscribers(topic string, subscribers int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if subscribers > 0 {
+		l.subscribers[topic] = subscribers
+		return
+	}
+	delete(l.subscribers, topic)
+	for key, s := range l.streams {
+		if s.topic == topic {
+			l.stop(key, s)
+		}
+	}
+}
+
+func (l *sharedStreams) users(s *sharedStream) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	users := make([]string, 0, len(s.refs))
+	for holder := range s.refs {
+		if !slices.Contains(users, holder.user) {
+			users = append(users, holder.user)
+		}
+	}
+	return users
+}
+
+// stop is called with the lock held.
+func (l *sharedStreams) stop(key string, s *sharedStream) {
+	s.cancel()
+	delete(l.streams, key)
+}
+
+func (l *sharedStreams) remove(key string, s *sharedStream) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.streams[key] == s {
+		l.stop(key, s)
+	}
+}
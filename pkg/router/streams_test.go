@@ -0,0 +1,65 @@
+package router
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSharedStreamsRefs(t *testing.T) {
+	l := newSharedStreams("logs stream")
+	alice := streamHolder{user: "alice", session: "1"}
+	bob := streamHolder{user: "bob", session: "2"}
+	started := make(chan func() []string, 2)
+	stopped := make(chan struct{}, 2)
+	run := func(ctx context.Context, users func() []string) {
+		started <- users
+		<-ctx.Done()
+		stopped <- struct{}{}
+	}
+	l.setSubscribers("logs", 1)
+	l.acquire(context.Background(), "logs|", "logs", alice, run)
+	l.acquire(context.Background(), "logs|", "logs", bob, run)
+	l.acquire(context.Background(), "logs|", "logs", bob, run)
+	users := <-started
+	if len(started) != 0 {
+		t.Fatal("expected a shared stream")
+	}
+	got := users()
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"alice", "bob"}) {
+		t.Fatalf("unexpected users %v", got)
+	}
+
+	l.release("logs", alice)
+	l.release("logs", bob)
+	if got := users(); !slices.Equal(got, []string{"bob"}) {
+		t.Fatalf("bob still holds a reference, got %v", got)
+	}
+	l.release("logs", bob)
+	expectStopped(t, stopped)
+
+	// the logout of a session keeps the stream of the other session
+	l.acquire(context.Background(), "logs|", "logs", alice, run)
+	l.acquire(context.Background(), "logs|", "logs", streamHolder{user: "alice", session: "3"}, run)
+	users = <-started
+	l.releaseSession(alice)
+	if got := users(); !slices.Equal(got, []string{"alice"}) {
+		t.Fatalf("the other session still holds a reference, got %v", got)
+	}
+	l.setSubscribers("logs", 0)
+	expectStopped(t, stopped)
+	if len(l.streams) != 0 {
+		t.Fatal("the stream without subscribers was not removed")
+	}
+}
+
+func expectStopped(t *testing.T, stopped chan struct{}) {
+	t.Helper()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the stream was not stopped")
+	}
+}
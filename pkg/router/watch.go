@@ -1,17 +1,15 @@
 package router
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 
 	"teleskopio/pkg/model"
+	"teleskopio/pkg/rbac"
 
 	"github.com/gin-gonic/gin"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	w "k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
 )
 
 func (r *Route) WatchDynamicResource(c *gin.Context) {
@@ -21,50 +19,35 @@ func (r *Route) WatchDynamicResource(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	ri, err := r.kapi.GetResourceInterface(req.Server, req.Namespace, &req.APIResource)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.APIResource.Kind, Verb: rbac.Watch}) {
 		return
 	}
-	watcherKey := fmt.Sprintf("%s-%s", req.APIResource.Kind, req.Server)
-	watch, err := ri.Watch(context.Background(), metav1.ListOptions{ResourceVersion: req.APIResource.ResourceVersion})
-	if err != nil {
+	user := r.impersonatedUser(c)
+	identity := r.kapi.Impersonated(c.Request.Context())
+	updatedTopic := watchTopic(req.APIResource.Kind, req.Server, req.Namespace, identity, "updated")
+	deletedTopic := watchTopic(req.APIResource.Kind, req.Server, req.Namespace, identity, "deleted")
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			r.hub.PublishUser(user, updatedTopic, obj)
+		},
+		UpdateFunc: func(_, newObj any) {
+			r.hub.PublishUser(user, updatedTopic, newObj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			r.hub.PublishUser(user, deletedTopic, obj)
+		},
+	}
+	topics := []string{updatedTopic, deletedTopic}
+	if err := r.kapi.WatchDynamicResource(c.Request.Context(), req, "", topics, handler); err != nil {
 		slog.Error("watcher", "err", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	ch := watch.ResultChan()
-	r.watchers.Store(watcherKey, watch)
-	gvr := req.APIResource.GetGVR()
-	slog.Info("Watching ...", "gvr", gvr.String())
-	go func() {
-		for event := range ch {
-			switch event.Type {
-			case w.Added, w.Modified:
-				slog.Debug("message received", "gvr", gvr.String(), "watchKey", watcherKey, "type", event.Type)
-				payload, _ := json.Marshal(map[string]any{
-					"event":   fmt.Sprintf("%s-%s-updated", req.APIResource.Kind, req.Server),
-					"payload": event.Object,
-				})
-				r.hub.Broadcast(payload)
-			case w.Deleted:
-				slog.Debug("message received", "gvr", gvr.String(), "watchKey", watcherKey, "type", event.Type)
-				payload, _ := json.Marshal(map[string]any{
-					"event":   fmt.Sprintf("%s-%s-deleted", req.APIResource.Kind, req.Server),
-					"payload": event.Object,
-				})
-				r.hub.Broadcast(payload)
-			case w.Error:
-				if status, ok := event.Object.(*metav1.Status); ok {
-					slog.Error("watching error", "gvr", gvr.String(), "watchKey", watcherKey, "code", status.Code, "reason", status.Reason, "msg", status.Message)
-				}
-				r.watchers.Delete(watcherKey)
-				return
-			}
-		}
-	}()
 
-	c.JSON(http.StatusOK, gin.H{"success": ""})
+	c.JSON(http.StatusOK, gin.H{"updated": r.subscription(c, updatedTopic), "deleted": r.subscription(c, deletedTopic)})
 }
 
 func (r *Route) WatchEventsDynamicResource(c *gin.Context) {
@@ -73,55 +56,63 @@ func (r *Route) WatchEventsDynamicResource(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	ri, err := r.kapi.GetResourceInterface(req.Server, req.Namespace, &req.APIResource)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
-		return
-	}
-	gvr := req.APIResource.GetGVR()
-	watcherKey := fmt.Sprintf("%s-%s-updated", req.UID, req.Server)
-	_, ok := r.watchers.Load(watcherKey)
-	if ok {
-		slog.Info("watcher exist", "gvr", gvr.String(), "key", watcherKey)
-		c.JSON(http.StatusOK, gin.H{"success": ""})
+	if !r.allowed(c, rbac.Request{Cluster: req.Server, Namespace: req.Namespace, Kind: req.APIResource.Kind, Verb: rbac.Watch}) {
 		return
 	}
-	watchOptions := metav1.ListOptions{ResourceVersion: req.APIResource.ResourceVersion}
 	fieldSelector := ""
 	if req.APIResource.Group == "" {
 		fieldSelector = fmt.Sprintf("involvedObject.uid=%s", req.UID)
 	} else {
 		fieldSelector = fmt.Sprintf("regarding.uid=%s", req.UID)
 	}
-	watchOptions.FieldSelector = fieldSelector
-	watch, err := ri.Watch(context.Background(), watchOptions)
-	if err != nil {
+	user := r.impersonatedUser(c)
+	topic := watchTopic(req.UID, req.Server, "", r.kapi.Impersonated(c.Request.Context()), "updated")
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			r.hub.PublishUser(user, topic, obj)
+		},
+		UpdateFunc: func(_, newObj any) {
+			r.hub.PublishUser(user, topic, newObj)
+		},
+	}
+	if err := r.kapi.WatchDynamicResource(c.Request.Context(), req, fieldSelector, []string{topic}, handler); err != nil {
 		slog.Error("watcher", "err", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	ch := watch.ResultChan()
-	r.watchers.Store(watcherKey, watch)
-	slog.Info("Watching ...", "gvr", gvr.String())
-	go func() {
-		for event := range ch {
-			switch event.Type {
-			case w.Added, w.Modified:
-				slog.Debug("message received", "gvr", gvr.String(), "watchKey", watcherKey, "type", event.Type)
-				payload, _ := json.Marshal(map[string]interface{}{
-					"event":   watcherKey,
-					"payload": event.Object,
-				})
-				r.hub.Broadcast(payload)
-			case w.Error:
-				if status, ok := event.Object.(*metav1.Status); ok {
-					slog.Error("watching error", "gvr", gvr.String(), "watchKey", watcherKey, "code", status.Code, "reason", status.Reason, "msg", status.Message)
-				}
-				r.watchers.Delete(watcherKey)
-				return
-			}
-		}
-	}()
 
-	c.JSON(http.StatusOK, gin.H{"success": ""})
+	c.JSON(http.StatusOK, gin.H{"updated": r.subscription(c, topic)})
+}
+
+// watchTopic is scoped like the informer key, the subscribers of a
+// namespace or of an impersonated identity only get the events of their
+// informer. identity is the one of the key, the user and its groups, so a
+// user with two sets of groups doesn't get the events of both informers.
+func watchTopic(kind, server, namespace, identity, event string) string {
+	scope := server
+	if namespace != "" {
+		scope += "/" + namespace
+	}
+	if identity != "" {
+		scope += "@" + identity
+	}
+	return fmt.Sprintf("%s-%s-%s", kind, scope, event)
+}
+
+// subscription hands out the topic to the websocket clients of the user, it's
+// called once the user is allowed to read what's published to it.
+func (r *Route) subscription(c *gin.Context, topic string) model.Subscription {
+	return r.hub.Subscription(c.GetString("username"), topic)
+}
+
+// impersonatedUser is the user the informers run as, their events are only
+// published to that user's websocket clients.
+func (r *Route) impersonatedUser(c *gin.Context) string {
+	if !r.kapi.Impersonate() {
+		return ""
+	}
+	if claims, ok := model.ClaimsFromContext(c.Request.Context()); ok {
+		return claims.Username
+	}
+	return ""
 }
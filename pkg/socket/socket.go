@@ -1,64 +1,217 @@
 package socket
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"log/slog"
 	"net/http"
+	"sync"
+	"time"
+
+	"teleskopio/pkg/model"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+const (
+	subscribeEvent   = "subscribe"
+	unsubscribeEvent = "unsubscribe"
+
+	// retainTTL - a retained message of a topic without subscribers is
+	// dropped after it
+	retainTTL = time.Minute
+)
+
+// controlMessage is the envelope of the control frames sent by the client.
+type controlMessage struct {
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type publication struct {
+	topic string
+	user  string
+	data  []byte
+	// allowed - nil delivers to every subscriber
+	allowed func(*model.Claims) bool
+	retain  bool
+	at      time.Time
+}
+
+type subscription struct {
+	client *Client
+	topic  string
+}
+
+// Observer is notified with the number of subscribers every time it changes
+// for a topic. It's called from the hub loop and must not publish.
+type Observer func(topic string, subscribers int)
+
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
+	clients map[*Client]map[string]bool
+	topics  map[string]int
+	// retained - the last retained message of every topic and user
+	retained    map[string]map[string]publication
+	publish     chan publication
+	register    chan *Client
+	unregister  chan *Client
+	subscribe   chan subscription
+	unsubscribe chan subscription
+
+	mu        sync.Mutex
+	observers []Observer
+	// key signs the subscription tokens, they don't outlive the process
+	key []byte
 }
 
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan []byte
+	claims *model.Claims
 }
 
 func NewHub() *Hub {
+	key := make([]byte, 32)
+	//nolint:errcheck
+	rand.Read(key)
 	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
+		key:         key,
+		publish:     make(chan publication),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		subscribe:   make(chan subscription),
+		unsubscribe: make(chan subscription),
+		clients:     make(map[*Client]map[string]bool),
+		topics:      make(map[string]int),
+		retained:    make(map[string]map[string]publication),
 	}
 }
 
+// Subscription signs the topic for the user, it's handed out by the endpoints
+// once the user is allowed to read what's published to the topic.
+func (h *Hub) Subscription(username, topic string) model.Subscription {
+	return model.Subscription{Topic: topic, Token: h.sign(username, topic)}
+}
+
+func (h *Hub) sign(username, topic string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(username + "\n" + topic))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Hub) Observe(o Observer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.observers = append(h.observers, o)
+}
+
 func (h *Hub) Run() {
+	prune := time.NewTicker(retainTTL)
+	defer prune.Stop()
 	for {
 		select {
+		case now := <-prune.C:
+			h.pruneRetained(now)
 		case client := <-h.register:
-			h.clients[client] = true
+			h.clients[client] = make(map[string]bool)
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			h.removeClient(client)
+		case sub := <-h.subscribe:
+			if topics, ok := h.clients[sub.client]; ok && !topics[sub.topic] {
+				topics[sub.topic] = true
+				h.changeSubscribers(sub.topic, 1)
+				for _, msg := range h.retained[sub.topic] {
+					h.deliver(sub.client, msg)
+				}
 			}
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					delete(h.clients, client)
-					close(client.send)
+		case sub := <-h.unsubscribe:
+			if topics, ok := h.clients[sub.client]; ok && topics[sub.topic] {
+				delete(topics, sub.topic)
+				h.changeSubscribers(sub.topic, -1)
+			}
+		case msg := <-h.publish:
+			if msg.retain {
+				if h.retained[msg.topic] == nil {
+					h.retained[msg.topic] = make(map[string]publication)
+				}
+				h.retained[msg.topic][msg.user] = msg
+			}
+			for client, topics := range h.clients {
+				if topics[msg.topic] {
+					h.deliver(client, msg)
 				}
 			}
 		}
 	}
 }
 
-func SetupWebsocket(hub *Hub, router *gin.Engine) {
+func (h *Hub) deliver(client *Client, msg publication) {
+	if !client.isUser(msg.user) || (msg.allowed != nil && !msg.allowed(client.claims)) {
+		return
+	}
+	select {
+	case client.send <- msg.data:
+	default:
+		h.removeClient(client)
+	}
+}
+
+// pruneRetained drops the retained messages nobody subscribed to in time.
+func (h *Hub) pruneRetained(now time.Time) {
+	for topic, msgs := range h.retained {
+		if h.topics[topic] > 0 {
+			continue
+		}
+		for user, msg := range msgs {
+			if now.Sub(msg.at) >= retainTTL {
+				delete(msgs, user)
+			}
+		}
+		if len(msgs) == 0 {
+			delete(h.retained, topic)
+		}
+	}
+}
+
+func (h *Hub) removeClient(client *Client) {
+	if topics, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+		for topic := range topics {
+			h.changeSubscribers(topic, -1)
+		}
+	}
+}
+
+func (h *Hub) changeSubscribers(topic string, delta int) {
+	h.topics[topic] += delta
+	subscribers := h.topics[topic]
+	if subscribers <= 0 {
+		delete(h.topics, topic)
+		// the last subscriber is gone, there's nobody left to replay to
+		delete(h.retained, topic)
+	}
+	h.mu.Lock()
+	observers := h.observers
+	h.mu.Unlock()
+	for _, o := range observers {
+		o(topic, subscribers)
+	}
+}
+
+// SetupWebsocket registers /ws behind the auth handlers, the claims set by
+// them are attached to the client.
+func SetupWebsocket(hub *Hub, router *gin.Engine, authHandlers ...gin.HandlerFunc) {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 	}
-	router.GET("/ws", func(c *gin.Context) {
+	router.GET("/ws", append(authHandlers, func(c *gin.Context) {
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			slog.Default().Error("error while Upgrading websocket connection", "err", err.Error())
@@ -68,13 +221,19 @@ func SetupWebsocket(hub *Hub, router *gin.Engine) {
 		}
 
 		client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256)}
+		if claims, ok := c.Get("claims"); ok {
+			client.claims, _ = claims.(*model.Claims)
+		}
 		client.hub.register <- client
 
 		go client.writePump()
 		go client.readPump()
-	})
+	})...)
 }
 
+// readPump only accepts subscription control messages, anything else sent
+// by the client is dropped. A subscription needs the token signed for the
+// client user.
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
@@ -86,21 +245,113 @@ func (c *Client) readPump() {
 			slog.Default().Error("read:", "err", err.Error())
 			break
 		}
-		c.hub.broadcast <- message
+		var msg controlMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			slog.Default().Debug("invalid ws message", "err", err.Error())
+			continue
+		}
+		var sub model.Subscription
+		if err := json.Unmarshal(msg.Payload, &sub); err != nil || sub.Topic == "" {
+			slog.Default().Debug("invalid ws topic", "event", msg.Event)
+			continue
+		}
+		switch msg.Event {
+		case subscribeEvent:
+			if !c.allowed(sub) {
+				slog.Default().Info("ws subscription refused", "user", c.username(), "topic", sub.Topic)
+				continue
+			}
+			c.hub.subscribe <- subscription{client: c, topic: sub.Topic}
+		case unsubscribeEvent:
+			c.hub.unsubscribe <- subscription{client: c, topic: sub.Topic}
+		default:
+			slog.Default().Debug("unsupported ws event", "event", msg.Event)
+		}
 	}
 }
 
+// writePump closes the connection once the client token expires, the client
+// has to reconnect with a fresh token.
 func (c *Client) writePump() {
 	defer c.conn.Close()
-	for msg := range c.send {
-		err := c.conn.WriteMessage(websocket.TextMessage, msg)
-		if err != nil {
-			slog.Default().Error("write:", "err", err.Error())
-			break
+	var expired <-chan time.Time
+	if c.claims != nil && c.claims.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(c.claims.ExpiresAt.Time))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				slog.Default().Error("write:", "err", err.Error())
+				return
+			}
+		case <-expired:
+			slog.Default().Debug("token expired, close ws connection", "user", c.claims.Username)
+			closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired")
+			//nolint:errcheck
+			c.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+			return
 		}
 	}
 }
 
-func (h *Hub) Broadcast(msg []byte) {
-	h.broadcast <- msg
+// Publish delivers payload to the clients subscribed to the topic, the topic
+// is sent as the message event.
+func (h *Hub) Publish(topic string, payload any) {
+	h.PublishUser("", topic, payload)
+}
+
+// PublishUser is Publish restricted to the clients logged in as username, an
+// empty username delivers to every subscriber.
+func (h *Hub) PublishUser(username, topic string, payload any) {
+	h.PublishAllowed(username, topic, payload, nil)
+}
+
+// PublishAllowed is PublishUser restricted to the subscribers allowed is true
+// for, it's called from the hub loop and gets nil claims when the auth is
+// disabled.
+func (h *Hub) PublishAllowed(username, topic string, payload any, allowed func(*model.Claims) bool) {
+	h.send(publication{topic: topic, user: username, allowed: allowed}, payload)
+}
+
+// PublishRetained is PublishUser keeping the message as the last one of the
+// topic for the user, it's sent to the clients subscribing later on. It's
+// kept until the last subscriber of the topic goes away, or for retainTTL
+// when nobody subscribes.
+func (h *Hub) PublishRetained(username, topic string, payload any) {
+	h.send(publication{topic: topic, user: username, retain: true, at: time.Now()}, payload)
+}
+
+func (h *Hub) send(msg publication, payload any) {
+	data, err := json.Marshal(map[string]any{
+		"event":   msg.topic,
+		"payload": payload,
+	})
+	if err != nil {
+		slog.Default().Error("marshal ws message", "topic", msg.topic, "err", err.Error())
+		return
+	}
+	msg.data = data
+	h.publish <- msg
+}
+
+// allowed checks the token was signed for the client user and the topic.
+func (c *Client) allowed(sub model.Subscription) bool {
+	return hmac.Equal([]byte(sub.Token), []byte(c.hub.sign(c.username(), sub.Topic)))
+}
+
+func (c *Client) username() string {
+	if c.claims == nil {
+		return ""
+	}
+	return c.claims.Username
+}
+
+func (c *Client) isUser(username string) bool {
+	return username == "" || (c.claims != nil && c.claims.Username == username)
 }
@@ -0,0 +1,147 @@
+package socket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"teleskopio/pkg/model"
+)
+
+func TestHubPublishOnlyToSubscribers(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	// the hub handles channels sequentially, once a register is accepted
+	// the previous publication has been delivered
+	barrier := func() {
+		hub.register <- &Client{hub: hub, send: make(chan []byte, 1)}
+	}
+
+	subscribed := &Client{hub: hub, send: make(chan []byte, 1)}
+	other := &Client{hub: hub, send: make(chan []byte, 1)}
+	hub.register <- subscribed
+	hub.register <- other
+	hub.subscribe <- subscription{client: subscribed, topic: "Pod-srv-updated"}
+	hub.subscribe <- subscription{client: other, topic: "Pod-other-updated"}
+
+	hub.Publish("Pod-srv-updated", map[string]string{"name": "nginx"})
+	barrier()
+
+	select {
+	case data := <-subscribed.send:
+		var msg map[string]any
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("unexpected message %s: %v", data, err)
+		}
+		if msg["event"] != "Pod-srv-updated" {
+			t.Fatalf("expected event Pod-srv-updated, got %v", msg["event"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscribed client did not receive the message")
+	}
+	select {
+	case data := <-other.send:
+		t.Fatalf("not subscribed client received %s", data)
+	default:
+	}
+
+	hub.unsubscribe <- subscription{client: subscribed, topic: "Pod-srv-updated"}
+	hub.Publish("Pod-srv-updated", nil)
+	barrier()
+	select {
+	case data := <-subscribed.send:
+		t.Fatalf("unsubscribed client received %s", data)
+	default:
+	}
+}
+
+func TestSubscriptionToken(t *testing.T) {
+	hub := NewHub()
+	alice := &Client{hub: hub, claims: &model.Claims{Username: "alice"}}
+	bob := &Client{hub: hub, claims: &model.Claims{Username: "bob"}}
+
+	sub := hub.Subscription("alice", "Secret-srv/team-a-updated")
+	if !alice.allowed(sub) {
+		t.Fatal("alice must be allowed with her token")
+	}
+	if bob.allowed(sub) {
+		t.Fatal("the token of alice must not work for bob")
+	}
+	sub.Topic = "Secret-srv-updated"
+	if alice.allowed(sub) {
+		t.Fatal("the token must not work for another topic")
+	}
+	if alice.allowed(model.Subscription{Topic: "Secret-srv-updated"}) {
+		t.Fatal("a subscription without token must be refused")
+	}
+}
+
+func TestHubPublishAllowed(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	barrier := func() {
+		hub.register <- &Client{hub: hub, send: make(chan []byte, 1)}
+	}
+
+	admin := &Client{hub: hub, send: make(chan []byte, 1), claims: &model.Claims{Username: "alice", Role: "admin"}}
+	oncall := &Client{hub: hub, send: make(chan []byte, 1), claims: &model.Claims{Username: "bob", Role: "oncall"}}
+	for _, c := range []*Client{admin, oncall} {
+		hub.register <- c
+		hub.subscribe <- subscription{client: c, topic: "helm-release-srv-added"}
+	}
+
+	hub.PublishAllowed("", "helm-release-srv-added", nil, func(claims *model.Claims) bool {
+		return claims != nil && claims.Role == "admin"
+	})
+	barrier()
+	if len(admin.send) != 1 {
+		t.Fatal("allowed subscriber did not receive the message")
+	}
+	if len(oncall.send) != 0 {
+		t.Fatal("not allowed subscriber received the message")
+	}
+}
+
+func TestHubRetained(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	barrier := func() {
+		hub.register <- &Client{hub: hub, send: make(chan []byte, 1)}
+	}
+
+	hub.PublishRetained("alice", "rollout", map[string]string{"message": "done"})
+	first := &Client{hub: hub, send: make(chan []byte, 2), claims: &model.Claims{Username: "alice"}}
+	hub.register <- first
+	hub.subscribe <- subscription{client: first, topic: "rollout"}
+	barrier()
+	if len(first.send) != 1 {
+		t.Fatal("the retained message was not replayed to the subscriber")
+	}
+
+	// the subscribed clients don't get the replay again
+	second := &Client{hub: hub, send: make(chan []byte, 2), claims: &model.Claims{Username: "alice"}}
+	other := &Client{hub: hub, send: make(chan []byte, 2), claims: &model.Claims{Username: "bob"}}
+	hub.register <- second
+	hub.register <- other
+	hub.subscribe <- subscription{client: second, topic: "rollout"}
+	hub.subscribe <- subscription{client: other, topic: "rollout"}
+	barrier()
+	if len(first.send) != 1 || len(second.send) != 1 {
+		t.Fatalf("expected one message per client, got %d and %d", len(first.send), len(second.send))
+	}
+	if len(other.send) != 0 {
+		t.Fatal("the message retained for alice was replayed to bob")
+	}
+
+	// gone with the last subscriber
+	for _, c := range []*Client{first, second, other} {
+		hub.unsubscribe <- subscription{client: c, topic: "rollout"}
+	}
+	late := &Client{hub: hub, send: make(chan []byte, 1), claims: &model.Claims{Username: "alice"}}
+	hub.register <- late
+	hub.subscribe <- subscription{client: late, topic: "rollout"}
+	barrier()
+	if len(late.send) != 0 {
+		t.Fatal("the retained message outlived the subscribers")
+	}
+}